@@ -1,12 +1,12 @@
 package app
 
 import (
-	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
 
 	"github.com/meixiu/utask/pkg/network"
+	"github.com/meixiu/utask/pkg/retry"
+	"github.com/meixiu/utask/pkg/success"
 
 	"gopkg.in/yaml.v2"
 )
@@ -14,9 +14,13 @@ import (
 type config struct {
 	Debug   bool   `json:"debug" yaml:"debug"`
 	Version string `json:"version" yaml:"version"`
+	Coder   string `json:"coder" yaml:"coder"`
 	Server  struct {
-		Addr string `json:"addr" yaml:"addr"`
-		Url  string `json:"url"`
+		Addr              string `json:"addr" yaml:"addr"`
+		Url               string `json:"url"`
+		MaxBatch          int    `json:"max_batch" yaml:"max_batch"`
+		IdempotencyWindow int64  `json:"idempotency_window" yaml:"idempotency_window"`
+		MaxTimeout        int64  `json:"max_timeout" yaml:"max_timeout"`
 	}
 	Db struct {
 		Driver        string `json:"driver" yaml:"driver"`
@@ -26,35 +30,51 @@ type config struct {
 		MaxRetryTimes int    `json:"max_retry_times" yaml:"max_retry_times"`
 		MaxLockTime   int64  `json:"max_lock_time" yaml:"max_lock_time"`
 	}
+	Retry struct {
+		Default retry.Policy            `json:"default" yaml:"default"`
+		Apps    map[string]retry.Policy `json:"apps" yaml:"apps"`
+	}
+	Success struct {
+		Default success.Rule            `json:"default" yaml:"default"`
+		Apps    map[string]success.Rule `json:"apps" yaml:"apps"`
+	}
 	Redis struct {
-		Addr     string `json:"addr" yaml:"addr"`
-		Password string `json:"password" yaml:"password"`
-		Db       int    `json:"db" yaml:"db"`
+		Addr        string         `json:"addr" yaml:"addr"`
+		Password    string         `json:"password" yaml:"password"`
+		Db          int            `json:"db" yaml:"db"`
+		ShardByType bool           `json:"shard_by_type" yaml:"shard_by_type"`
+		Weights     map[string]int `json:"weights" yaml:"weights"`
+	}
+	Crypto struct {
+		Enable  bool              `json:"enable" yaml:"enable"`
+		KeyID   string            `json:"key_id" yaml:"key_id"`
+		Keys    map[string]string `json:"keys" yaml:"keys"`
+		Columns string            `json:"columns" yaml:"columns"`
 	}
 	Cli struct {
 		MaxWaits   int `json:"max_waits" yaml:"max_waits"`
 		MaxProcess int `json:"max_process" yaml:"max_process"`
+		MaxWheel   int `json:"max_wheel" yaml:"max_wheel"`
 	}
 }
 
 var (
-	Config *config
+	// Config 当前配置, 调用Load前为空配置
+	Config = &config{}
 )
 
-func init() {
-	loadConfig()
-}
-
-func loadConfig() {
-	file := flag.String("c", "config/dev.yaml", "config file path")
-	flag.Parse()
-	data, err := ioutil.ReadFile(*file)
+// Load 读取yaml配置文件替换当前配置, 需要在创建数据源、生产者和消费者之前调用
+func Load(path string) error {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	if err := yaml.Unmarshal(data, &Config); err != nil {
-		log.Fatal(err)
+	c := &config{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return err
 	}
+	Config = c
+	return nil
 }
 
 // ServerId 生产者进程ID
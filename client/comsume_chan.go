@@ -2,6 +2,8 @@ package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/meixiu/utask/app"
@@ -9,6 +11,7 @@ import (
 	"github.com/meixiu/utask/monitor"
 	"github.com/meixiu/utask/store"
 	"github.com/meixiu/utask/task"
+	"github.com/meixiu/utask/workflow"
 )
 
 const (
@@ -16,6 +19,12 @@ const (
 	FetchProcessStoreSize = 10
 	//默认窃取长度
 	StealProcessStoreSize = 10
+	//默认调度区单次移动长度
+	PromoteDelayStoreSize = 100
+	//默认单次检查停滞工作流长度
+	SweepWorkflowSize = 10
+	//默认时间轮容纳任务数
+	DefaultWheelSize = 10000
 )
 
 // ChanClient 利用chan的消费者类型
@@ -29,11 +38,13 @@ type ChanClient struct {
 	processStore store.ProcessStorer     // 任务处理数据源
 	logStore     store.LogStorer         // 任务日志数据源
 	monitor      monitor.ConsumerMonitor // 任务监控
+	workflow     *workflow.Runner        // 工作流执行器
 
-	stop    chan struct{}    // 处理停止信号
-	suspend chan bool        // 处理暂停信号
-	process chan struct{}    // 当前处理计数
-	waits   chan task.Tasker // 等待处理队列
+	stop    chan struct{} // 处理停止信号
+	suspend chan bool     // 处理暂停信号
+	process chan struct{} // 当前处理计数
+	waits   *waitQueue    // 等待处理队列, 按优先级出队
+	wheel   *timeWheel    // 近期到期任务的时间轮
 
 	maxWaits   int // 队列等待数 默认：128
 	maxProcess int // 处理并发数 默认：64
@@ -41,6 +52,10 @@ type ChanClient struct {
 
 // NewChanClient 返回一个消费客户端
 func NewChanClient(id string, opts Options) Consumer {
+	maxWheel := app.Config.Cli.MaxWheel
+	if maxWheel <= 0 {
+		maxWheel = DefaultWheelSize
+	}
 	return &ChanClient{
 		id:       id,
 		interval: time.Second,
@@ -50,10 +65,15 @@ func NewChanClient(id string, opts Options) Consumer {
 		logStore:     opts.LogStore,
 		secretStore:  opts.SecretStore,
 		monitor:      opts.Monitor,
+		workflow: workflow.NewRunner(id, workflow.NewOptions(
+			workflow.TaskStore(opts.TaskStore),
+			workflow.WorkflowStore(opts.WorkflowStore),
+		)),
 
 		stop:       make(chan struct{}),
 		suspend:    make(chan bool, 1),
-		waits:      make(chan task.Tasker, app.Config.Cli.MaxWaits),
+		waits:      newWaitQueue(app.Config.Cli.MaxWaits),
+		wheel:      newTimeWheel(time.Now().Unix(), maxWheel),
 		process:    make(chan struct{}, app.Config.Cli.MaxProcess),
 		maxWaits:   app.Config.Cli.MaxWaits,
 		maxProcess: app.Config.Cli.MaxProcess,
@@ -90,6 +110,12 @@ func (c *ChanClient) Start() error {
 	stealTimer := time.NewTimer(0) //窃取上次关闭未完成任务和超时任务 计时器
 	defer stealTimer.Stop()
 
+	delayTimer := time.NewTimer(0) //到期的延时、重试任务移回任务数据源 计时器
+	defer delayTimer.Stop()
+
+	wheelTimer := time.NewTimer(0) //时间轮推进 计时器, 对齐到整秒
+	defer wheelTimer.Stop()
+
 	for {
 		//操作信号
 		select {
@@ -148,53 +174,78 @@ func (c *ChanClient) Start() error {
 					stealTimer.Reset(c.interval)
 				}()
 				log.Info("client steal info")
-				_, err := c.Steal()
-				if err != nil {
+				if _, err := c.Steal(); err != nil {
 					log.Error("client steal error: ", err)
+				}
+				if _, err := c.Recover(); err != nil {
+					log.Error("client recover error: ", err)
+				}
+				if _, err := c.workflow.Sweep(SweepWorkflowSize); err != nil {
+					log.Error("client workflow sweep error: ", err)
+				}
+			}, nil)
+		case <-delayTimer.C:
+			async(func() {
+				defer func() {
+					delayTimer.Reset(c.interval)
+				}()
+				log.Info("client promote info")
+				_, err := c.Promote()
+				if err != nil {
+					log.Error("client promote error: ", err)
 					return
 				}
 			}, nil)
-		case item := <-c.waits: //处理队列 c.waits -> process
-			async(func() { _ = c.Dispose(item) }, c.process)
+		case now := <-wheelTimer.C: //时间轮到期任务 c.waits <- wheel
+			wheelTimer.Reset(time.Unix(now.Unix()+1, 0).Sub(time.Now()))
+			if items := c.wheel.Advance(now.Unix()); len(items) > 0 {
+				async(func() { c.Add(c.Claim(items...)...) }, nil)
+			}
+		case <-c.waits.Ready(): //处理队列 c.waits -> process, 取得处理名额后再取出优先级最高的任务
+			async(func() {
+				if item, ok := c.waits.Pop(); ok {
+					_ = c.Dispose(item)
+				}
+			}, c.process)
 		}
 	}
 }
 
 // Stop 停止队列, 只能停止一次
 func (c *ChanClient) Stop(ctx context.Context) error {
-	c.stop <- struct{}{}                               //发送成功才会继续
-	tempProcess := make(chan struct{}, len(c.waits)+1) //尽可能全部重置
+	c.stop <- struct{}{}                                //发送成功才会继续
+	tempProcess := make(chan struct{}, c.waits.Len()+1) //尽可能全部重置
+
+	//时间轮中的任务全部标记为可窃取
+	for _, item := range c.wheel.Drain() {
+		item := item //循环变量->局部变量
+		async(func() { _ = c.Reset(item, true) }, tempProcess)
+	}
 
 	t := time.NewTicker(c.interval / 10)
 	defer t.Stop()
 	for {
-		if len(c.waits)+len(c.process)+len(tempProcess) == 0 {
+		if c.waits.Len()+len(c.process)+len(tempProcess) == 0 {
 			return nil
 		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case item := <-c.waits:
-			async(func() { _ = c.Reset(item, true) }, tempProcess)
+		case <-c.waits.Ready():
+			if item, ok := c.waits.Pop(); ok {
+				async(func() { _ = c.Reset(item, true) }, tempProcess)
+			}
 		case <-t.C: //尽快重新进入循环，防止超时
 		}
 	}
 }
 
-// Add 接收队列项到内存channel
+// Add 接收队列项到内存等待队列
 func (c *ChanClient) Add(items ...task.Tasker) {
 	//此处可能有性能问题, 因此丢弃掉超时的
 	//结果是这些数据会在超时任务区处理
-	t := time.NewTimer(0)
-	defer t.Stop()
-	<-t.C
 	for _, item := range items {
-		item := item //循环变量->局部变量
-		t.Reset(time.Duration(item.Timeout()) * time.Second)
-		select {
-		case c.waits <- item:
-		case <-t.C:
-		}
+		c.waits.Push(item, time.Duration(item.Timeout())*time.Second)
 	}
 }
 
@@ -207,9 +258,19 @@ func (c *ChanClient) Normal() (count int, err error) {
 	if item == nil {
 		return 0, nil
 	}
-	//是否立即处理
-	if int64(c.interval/time.Second) > item.GetExpectTime()-time.Now().Unix() {
+	//是否立即处理, 近期到期的任务进入时间轮
+	if int64(c.interval/time.Second) > item.GetExpectTime()-time.Now().Unix() || c.wheel.Covers(item.GetExpectTime()) {
 		item.SetProcessing()
+	} else {
+		//延时任务进入调度区, 到期后重新进入任务数据源
+		ok, err := c.Delay(item, item.GetExpectTime())
+		if err != nil {
+			log.Error("client normal delay err, task: ", item, " delay err: ", err)
+		}
+		if ok {
+			c.Confirm(item)
+			return 1, nil
+		}
 	}
 
 	//拉取到一个任务
@@ -222,21 +283,79 @@ func (c *ChanClient) Normal() (count int, err error) {
 		if errPush != nil || !ok {
 			//这条记录需要重发
 			log.Error("client normal push err, task: ", item, "insert err: ", err, " push back status: ", ok, " push back err: ", errPush)
+			return 0, err
 		}
+		//已放回数据源, 确认掉本次取出
+		c.Confirm(item)
 		return 0, err
 	}
 	//二次确认
-	if cs, ok := c.processStore.(store.ConfirmTaskStorer); ok {
-		errConfirm := cs.Confirm(item.GetID())
-		if errConfirm != nil {
+	c.Confirm(item)
+	if item.IsProcessing() {
+		c.Schedule(item, item.GetExpectTime())
+	}
+	return 1, nil
+}
+
+// Confirm 二次确认任务已从数据源取出
+func (c *ChanClient) Confirm(item task.Tasker) {
+	if cs, ok := c.taskStore.(store.ConfirmTaskStorer); ok {
+		err := cs.Confirm(item.GetID())
+		if err != nil {
 			//这条记录会重发
-			log.Error("client normal confirm err, task: ", item, "insert err: ", err, " push back status: ", ok, " push back err: ", errConfirm)
+			log.Error("client confirm err, task: ", item, " confirm err: ", err)
 		}
 	}
-	if item.IsProcessing() {
-		c.Add(item)
+}
+
+// Schedule 将任务在at时间放入等待处理队列, 已到期的立即放入
+func (c *ChanClient) Schedule(item task.Tasker, at int64) {
+	if at <= time.Now().Unix() {
+		c.Add(c.Claim(item)...)
+		return
+	}
+	if c.wheel.Add(item, at) {
+		return
+	}
+	//时间轮已满, 未到期的任务交回调度区, 不支持调度时解除锁定到期后由Abnormal重新拉取
+	ok, err := c.Delay(item, at)
+	if err != nil {
+		log.Error("client schedule delay err, task: ", item, " delay err: ", err)
+	}
+	if ok {
+		if _, err := c.Delete(item); err != nil {
+			log.Error("client schedule delete err, task: ", item, " delete err: ", err)
+		}
+		return
+	}
+	store.UnsetProcessing(item)
+	if _, err := c.processStore.Update(c.id, item); err != nil {
+		log.Error("client schedule update err, task: ", item, " update err: ", err)
 	}
-	return 1, nil
+}
+
+// Claim 调度的任务开始执行前在任务处理区锁定, 丢弃等待期间被修改、取消或被其他消费者取出的任务
+// 丢弃的任务以任务处理区为准, 修改后的任务到期后由Abnormal重新拉取
+func (c *ChanClient) Claim(items ...task.Tasker) []task.Tasker {
+	s, ok := c.processStore.(store.ClaimProcessStorer)
+	if !ok {
+		return items
+	}
+	claimed := make([]task.Tasker, 0, len(items))
+	for _, item := range items {
+		ok, err := s.Claim(c.id, item.GetID())
+		if err != nil {
+			//无法确认时不执行, 租用到期后由Abnormal重新拉取
+			log.Error("client claim err, task: ", item, " claim err: ", err)
+			continue
+		}
+		if !ok {
+			log.Info("client claim skip: ", item.GetID())
+			continue
+		}
+		claimed = append(claimed, item)
+	}
+	return claimed
 }
 
 // Abnormal 获取任务处理区数据 (出错重试、超时重试、延时任务)
@@ -258,14 +377,45 @@ func (c *ChanClient) Abnormal() (count int, err error) {
 // Reset 重置下次处理时间
 func (c *ChanClient) Reset(item task.Tasker, forStop bool) (err error) {
 	id := c.id
-	//设置下次处理时间
+	//离开待处理队列, 设置下次处理时间
+	store.UnsetProcessing(item)
 	if forStop {
 		if s, ok := c.processStore.(store.StealProcessStorer); ok {
 			_, err = s.Mark(c.id, item)
 			return err
 		}
 	} else {
-		item.IncreaseTimes()
+		//按重试策略设置下次执行时间, 达到最大执行次数或永久失败的任务移入死信
+		exhausted := store.Retry(item)
+		if lastErr := item.GetLastError(); task.IsPermanent(lastErr) {
+			return c.Bury(item, lastErr.Error())
+		} else if exhausted {
+			//记录耗尽原因, 同时保留最后一次错误
+			reason := "exceeded max retry times"
+			if lastErr != nil {
+				reason = fmt.Sprintf("%s: %v", reason, lastErr)
+			}
+			return c.Bury(item, reason)
+		}
+		//近期重试的任务锁定后进入时间轮
+		if c.wheel.Covers(item.GetNextTime()) {
+			item.SetProcessing()
+			_, err = c.processStore.Update(id, item)
+			if err != nil {
+				return err
+			}
+			c.Schedule(item, item.GetNextTime())
+			return nil
+		}
+		//重试任务进入调度区, 到期后重新进入任务数据源
+		ok, err := c.Delay(item, item.GetNextTime())
+		if err != nil {
+			log.Error("client reset delay err, task: ", item, " delay err: ", err)
+		}
+		if ok {
+			_, err = c.Delete(item)
+			return err
+		}
 	}
 	_, err = c.processStore.Update(id, item)
 	if err != nil {
@@ -283,10 +433,33 @@ func (c *ChanClient) Dispose(item task.Tasker) (err error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), timeout)
 	defer cancel()
 
+	//标记开始执行, 拉取后被取消的任务不再执行
+	if ok, err := c.Acquire(item, timeout); err != nil {
+		log.Error("client dispose acquire err: ", err, item)
+	} else if !ok {
+		log.Info("client dispose cancelled: ", tid)
+		_, err = c.Delete(item)
+		c.Fail(item, "cancelled")
+		return err
+	} else {
+		defer c.Release(item)
+	}
+
+	//旧版本任务的请求参数改为兼容的值, 执行时校验失败的任务不再重试, 直接移入死信
+	if n, ok := item.(task.Normalizer); ok && n.Normalize() {
+		log.Info("client dispose normalize legacy task: ", tid, item)
+	}
+	if err := item.Validate(); err != nil {
+		log.Error("client dispose validate err: ", err, item)
+		return c.Bury(item, err.Error())
+	}
+
 	token, err := c.secretStore.Generate(tid, timeout)
 	if err != nil {
 		return err
 	}
+	//本次是第attempt次执行, 失败时由Retry计入执行次数
+	attempt := item.GetTimes() + 1
 	_, err = item.Run(ctx, token)
 	c.monitor.HandleTask(c.id, item)
 	_ = c.Log(item)
@@ -298,9 +471,78 @@ func (c *ChanClient) Dispose(item task.Tasker) (err error) {
 	}
 	_, err = c.Delete(item)
 	log.Info("client dispose del: ", tid, item, err)
+	c.Callback(item, nil, attempt)
+	c.Advance(item)
 	return nil
 }
 
+// Bury 将任务移入死信, 任务处理区不支持死信时仅更新任务
+func (c *ChanClient) Bury(item task.Tasker, reason string) error {
+	store.UnsetProcessing(item)
+	c.monitor.DeadTask(c.id, item)
+	//移入死信前失败的执行都已计入执行次数
+	c.Callback(item, errors.New(reason), item.GetTimes())
+	c.Fail(item, reason)
+	s, ok := c.processStore.(store.DeadProcessStorer)
+	if !ok {
+		_, err := c.processStore.Update(c.id, item)
+		return err
+	}
+	_, err := s.Bury(c.id, item, reason)
+	return err
+}
+
+// Callback 推送回调任务通知推送方执行结果, err为nil表示执行成功, times为已执行次数
+func (c *ChanClient) Callback(item task.Tasker, err error, times int64) {
+	cb, ok := item.(task.Callbacker)
+	if !ok {
+		return
+	}
+	t := cb.Callback(err, times)
+	if t == nil {
+		return
+	}
+	//回调任务作为普通任务推送, 执行时同样携带U-Task-Token供推送方校验
+	t.Init(c.id)
+	ok, pushErr := c.taskStore.RPush(t)
+	if pushErr != nil || !ok {
+		log.Error("client callback push err, task: ", item, " callback: ", t, " push status: ", ok, " push err: ", pushErr)
+		return
+	}
+	log.Info("client callback push: ", item.GetID(), " callback: ", t.GetID())
+}
+
+// Advance 工作流节点任务成功后推送后续节点
+func (c *ChanClient) Advance(item task.Tasker) {
+	if err := c.workflow.Advance(item); err != nil {
+		log.Error("client workflow advance err, task: ", item, " err: ", err)
+	}
+}
+
+// Fail 工作流节点任务成为死信或被取消时工作流失败
+func (c *ChanClient) Fail(item task.Tasker, reason string) {
+	if err := c.workflow.Fail(item, reason); err != nil {
+		log.Error("client workflow fail err, task: ", item, " err: ", err)
+	}
+}
+
+// Acquire 标记任务开始执行, 任务已取消时返回false, 数据源不支持取消时返回true
+func (c *ChanClient) Acquire(item task.Tasker, lifetime time.Duration) (bool, error) {
+	if s, ok := c.taskStore.(store.CancelTaskStorer); ok {
+		return s.Acquire(item.GetID(), lifetime)
+	}
+	return true, nil
+}
+
+// Release 清除任务的执行标记
+func (c *ChanClient) Release(item task.Tasker) {
+	if s, ok := c.taskStore.(store.CancelTaskStorer); ok {
+		if err := s.Release(item.GetID()); err != nil {
+			log.Error("client release err, task: ", item, " release err: ", err)
+		}
+	}
+}
+
 // Delete 从任务处理区删除
 func (c *ChanClient) Delete(item task.Tasker) (bool, error) {
 	return c.processStore.Delete(c.id, item.GetID())
@@ -324,6 +566,38 @@ func (c *ChanClient) Steal() (int64, error) {
 	return 0, nil
 }
 
+// Delay 将任务加入任务数据源的调度区, 数据源不支持调度时返回false
+func (c *ChanClient) Delay(item task.Tasker, at int64) (bool, error) {
+	if s, ok := c.taskStore.(store.DelayTaskStorer); ok {
+		return s.Delay(item, at)
+	}
+	return false, nil
+}
+
+// Promote 将到期的延时、重试任务移回任务数据源
+func (c *ChanClient) Promote() (count int64, err error) {
+	s, ok := c.taskStore.(store.DelayTaskStorer)
+	if !ok {
+		return 0, nil
+	}
+	for {
+		//只提前取出下次检查前到期的任务, 更晚到期的任务留在调度区, 避免大量任务进入内存
+		n, err := s.Promote(time.Now().Add(c.interval).Unix(), PromoteDelayStoreSize)
+		count += n
+		if err != nil || n < PromoteDelayStoreSize {
+			return count, err
+		}
+	}
+}
+
+// Recover 回收失效消费者未确认的任务
+func (c *ChanClient) Recover() (int64, error) {
+	if s, ok := c.taskStore.(store.RecoverTaskStorer); ok {
+		return s.Recover()
+	}
+	return 0, nil
+}
+
 // async 简单的控制协程数量的函数
 func async(f func(), c chan struct{}) {
 	if c == nil || cap(c) == 0 {
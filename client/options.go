@@ -10,11 +10,12 @@ import (
 
 // Options option info
 type Options struct {
-	TaskStore    store.TaskStorer
-	SecretStore  store.SecretStorer
-	ProcessStore store.ProcessStorer
-	LogStore     store.LogStorer
-	Monitor      monitor.ConsumerMonitor
+	TaskStore     store.TaskStorer
+	SecretStore   store.SecretStorer
+	ProcessStore  store.ProcessStorer
+	LogStore      store.LogStorer
+	WorkflowStore store.WorkflowStorer
+	Monitor       monitor.ConsumerMonitor
 }
 
 // Option Option
@@ -25,10 +26,14 @@ func NewOptions(opts ...Option) Options {
 	opt := Options{
 		TaskStore:    store.DefaultRedisStore,
 		SecretStore:  store.DefaultRedisStore,
-		ProcessStore: store.DefaultMysqlStore,
-		LogStore:     store.DefaultMysqlStore,
+		ProcessStore: store.DefaultDbStore,
+		LogStore:     store.DefaultDbStore,
 		Monitor:      monitor.DefaultPromMonitor,
 	}
+	//工作流区使用任务处理区的数据库
+	if s, ok := store.DefaultDbStore.(store.WorkflowStorer); ok {
+		opt.WorkflowStore = s
+	}
 	for _, o := range opts {
 		o(&opt)
 	}
@@ -63,6 +68,13 @@ func LogStore(l store.LogStorer) Option {
 	}
 }
 
+// WorkflowStore workflow store
+func WorkflowStore(w store.WorkflowStorer) Option {
+	return func(o *Options) {
+		o.WorkflowStore = w
+	}
+}
+
 // Monitor monitor
 func Monitor(m monitor.ConsumerMonitor) Option {
 	return func(o *Options) {
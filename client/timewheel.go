@@ -0,0 +1,139 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/meixiu/utask/task"
+)
+
+// timeWheel 分层时间轮, 秒级精度
+// 第0层每格1秒共60格, 第1层每格60秒共60格, 可以容纳一小时内到期的最多max个任务
+type timeWheel struct {
+	mu      sync.Mutex
+	levels  []*wheelLevel // 由低到高的时间轮层
+	current int64         // 已推进到的时间戳(秒)
+	due     []task.Tasker // 已到期待取出的任务
+	size    int           // 时间轮中的任务数
+	max     int           // 时间轮最多容纳的任务数
+}
+
+// wheelLevel 时间轮的一层
+type wheelLevel struct {
+	tick  int64         // 每格代表的秒数
+	slots [][]wheelItem // 格子
+}
+
+// wheelItem 时间轮中的任务
+type wheelItem struct {
+	at   int64 // 到期时间戳(秒)
+	item task.Tasker
+}
+
+// newTimeWheel 返回一个从now开始推进、最多容纳max个任务的时间轮
+func newTimeWheel(now int64, max int) *timeWheel {
+	return &timeWheel{
+		levels: []*wheelLevel{
+			{tick: 1, slots: make([][]wheelItem, 60)},
+			{tick: 60, slots: make([][]wheelItem, 60)},
+		},
+		current: now,
+		max:     max,
+	}
+}
+
+// Horizon 时间轮能容纳的最大时长(秒)
+func (w *timeWheel) Horizon() int64 {
+	top := w.levels[len(w.levels)-1]
+	return top.tick * int64(len(top.slots))
+}
+
+// Covers 判断at时间是否在时间轮范围内且时间轮未满
+func (w *timeWheel) Covers(at int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return at-w.current < w.Horizon() && w.size < w.max
+}
+
+// Add 加入一个在at时间到期的任务, 超出时间轮范围或时间轮已满时返回false
+func (w *timeWheel) Add(item task.Tasker, at int64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if at-w.current >= w.Horizon() || w.size >= w.max {
+		return false
+	}
+	w.place(wheelItem{at: at, item: item})
+	w.size++
+	return true
+}
+
+// Advance 推进时间轮到now, 返回期间到期的任务
+func (w *timeWheel) Advance(now int64) []task.Tasker {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.current < now {
+		w.current++
+		//高层到达边界时降级到低层
+		for i := len(w.levels) - 1; i > 0; i-- {
+			l := w.levels[i]
+			if w.current%l.tick != 0 {
+				continue
+			}
+			idx := (w.current / l.tick) % int64(len(l.slots))
+			items := l.slots[idx]
+			l.slots[idx] = nil
+			for _, v := range items {
+				w.place(v)
+			}
+		}
+		l := w.levels[0]
+		idx := w.current % int64(len(l.slots))
+		for _, v := range l.slots[idx] {
+			w.due = append(w.due, v.item)
+		}
+		l.slots[idx] = nil
+	}
+	due := w.due
+	w.due = nil
+	w.size -= len(due)
+	return due
+}
+
+// Drain 取出时间轮中的全部任务
+func (w *timeWheel) Drain() []task.Tasker {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	items := w.due
+	for _, l := range w.levels {
+		for i, slot := range l.slots {
+			for _, v := range slot {
+				items = append(items, v.item)
+			}
+			l.slots[i] = nil
+		}
+	}
+	w.due = nil
+	w.size = 0
+	return items
+}
+
+// Len 时间轮中的任务数
+func (w *timeWheel) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// place 将任务放入能容纳它的最低层, 已到期的直接放入到期列表
+func (w *timeWheel) place(v wheelItem) {
+	if v.at <= w.current {
+		w.due = append(w.due, v.item)
+		return
+	}
+	for _, l := range w.levels {
+		if v.at-w.current < l.tick*int64(len(l.slots)) {
+			idx := (v.at / l.tick) % int64(len(l.slots))
+			l.slots[idx] = append(l.slots[idx], v)
+			return
+		}
+	}
+}
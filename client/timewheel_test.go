@@ -0,0 +1,111 @@
+package client
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/meixiu/utask/task"
+)
+
+func TestTimeWheel(t *testing.T) {
+	const now = int64(1000000)
+	cases := []struct {
+		name    string
+		at      []int64 // 任务到期时间, 相对now
+		advance []int64 // 逐次推进到的时间, 相对now
+		want    [][]int // 每次推进取出的任务下标
+	}{
+		{"due now", []int64{0, -5}, []int64{0}, [][]int{{0, 1}}},
+		{"first level", []int64{1, 3, 3}, []int64{1, 2, 3}, [][]int{{0}, nil, {1, 2}}},
+		{"skip ahead", []int64{5, 30, 59}, []int64{40}, [][]int{{0, 1}}},
+		{"second level", []int64{60, 61, 125}, []int64{59, 60, 61, 124, 125}, [][]int{nil, {0}, {1}, nil, {2}}},
+		{"level boundary", []int64{119, 120, 121}, []int64{120, 121}, [][]int{{0, 1}, {2}}},
+		{"last slot", []int64{3599}, []int64{3598, 3599}, [][]int{nil, {0}}},
+	}
+	for _, c := range cases {
+		w := newTimeWheel(now, 100)
+		items := make([]task.Tasker, len(c.at))
+		for i, at := range c.at {
+			items[i] = &task.HttpTask{ID: strconv.Itoa(i)}
+			if !w.Add(items[i], now+at) {
+				t.Fatalf("%s: Add(%d) = false", c.name, at)
+			}
+		}
+		for i, at := range c.advance {
+			got := ids(w.Advance(now + at))
+			want := make([]string, 0)
+			for _, j := range c.want[i] {
+				want = append(want, items[j].GetID())
+			}
+			if !equal(got, want) {
+				t.Errorf("%s: Advance(%d) = %v, want %v", c.name, at, got, want)
+			}
+		}
+	}
+}
+
+func TestTimeWheelHorizon(t *testing.T) {
+	const now = int64(1000000)
+	w := newTimeWheel(now, 100)
+	if h := w.Horizon(); h != 3600 {
+		t.Fatalf("Horizon() = %d, want 3600", h)
+	}
+	if w.Add(&task.HttpTask{ID: "far"}, now+3600) {
+		t.Error("Add(now+3600) = true, want false")
+	}
+	if !w.Covers(now+3599) || w.Covers(now+3600) {
+		t.Error("Covers does not match Horizon")
+	}
+	w.Add(&task.HttpTask{ID: "a"}, now+10)
+	w.Add(&task.HttpTask{ID: "b"}, now+1000)
+	if n := w.Len(); n != 2 {
+		t.Fatalf("Len() = %d, want 2", n)
+	}
+	w.Advance(now + 10)
+	if n := w.Len(); n != 1 {
+		t.Fatalf("Len() after Advance = %d, want 1", n)
+	}
+	if got := ids(w.Drain()); !equal(got, []string{"b"}) {
+		t.Errorf("Drain() = %v, want [b]", got)
+	}
+	if n := w.Len(); n != 0 {
+		t.Errorf("Len() after Drain = %d, want 0", n)
+	}
+}
+
+func TestTimeWheelFull(t *testing.T) {
+	const now = int64(1000000)
+	w := newTimeWheel(now, 2)
+	w.Add(&task.HttpTask{ID: "a"}, now+10)
+	w.Add(&task.HttpTask{ID: "b"}, now+20)
+	if w.Covers(now+30) || w.Add(&task.HttpTask{ID: "c"}, now+30) {
+		t.Error("full wheel accepts task")
+	}
+	w.Advance(now + 10)
+	if !w.Covers(now+30) || !w.Add(&task.HttpTask{ID: "c"}, now+30) {
+		t.Error("wheel rejects task after Advance")
+	}
+}
+
+// ids 返回排序后的任务ID
+func ids(items []task.Tasker) []string {
+	s := make([]string, 0, len(items))
+	for _, v := range items {
+		s = append(s, v.GetID())
+	}
+	sort.Strings(s)
+	return s
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
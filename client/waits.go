@@ -0,0 +1,123 @@
+package client
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+)
+
+// waitQueue 按优先级出队的等待处理队列, 同优先级先进先出
+type waitQueue struct {
+	mu    sync.Mutex
+	items waitHeap
+	seq   uint64        // 入队序号
+	size  int           // 队列容量
+	ready chan struct{} // 队列非空信号
+	space chan struct{} // 队列有空位信号
+}
+
+// waitItem 等待处理队列中的任务
+type waitItem struct {
+	item     task.Tasker
+	priority int // 入队时的优先级
+	seq      uint64
+}
+
+// newWaitQueue 返回一个容量为size的等待处理队列
+func newWaitQueue(size int) *waitQueue {
+	if size < 1 {
+		size = 1
+	}
+	return &waitQueue{
+		size:  size,
+		ready: make(chan struct{}, 1),
+		space: make(chan struct{}, 1),
+	}
+}
+
+// Push 加入一个任务, 队列已满时最多等待timeout, 超时返回false
+func (q *waitQueue) Push(item task.Tasker, timeout time.Duration) bool {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		q.mu.Lock()
+		if len(q.items) < q.size {
+			q.seq++
+			heap.Push(&q.items, waitItem{item: item, priority: store.PriorityOf(item), seq: q.seq})
+			q.mu.Unlock()
+			notify(q.ready)
+			return true
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.space:
+		case <-t.C:
+			return false
+		}
+	}
+}
+
+// Pop 取出优先级最高的任务, 队列为空时返回false
+func (q *waitQueue) Pop() (task.Tasker, bool) {
+	q.mu.Lock()
+	if len(q.items) == 0 {
+		q.mu.Unlock()
+		return nil, false
+	}
+	v := heap.Pop(&q.items).(waitItem)
+	left := len(q.items)
+	q.mu.Unlock()
+	if left > 0 {
+		notify(q.ready)
+	}
+	notify(q.space)
+	return v.item, true
+}
+
+// Len 队列中的任务数
+func (q *waitQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Ready 队列非空时可读
+func (q *waitQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// notify 非阻塞的发送信号
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// waitHeap 优先级降序、入队序号升序的堆
+type waitHeap []waitItem
+
+func (h waitHeap) Len() int { return len(h) }
+
+func (h waitHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h waitHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *waitHeap) Push(x interface{}) { *h = append(*h, x.(waitItem)) }
+
+func (h *waitHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	v := old[n-1]
+	old[n-1] = waitItem{}
+	*h = old[:n-1]
+	return v
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meixiu/utask/task"
+)
+
+func TestWaitQueueOrder(t *testing.T) {
+	cases := []struct {
+		name  string
+		items []task.HttpTask
+		want  []string
+	}{
+		{"fifo", []task.HttpTask{{ID: "a"}, {ID: "b"}, {ID: "c"}}, []string{"a", "b", "c"}},
+		{"priority", []task.HttpTask{{ID: "a", Priority: 1}, {ID: "b", Priority: 9}, {ID: "c", Priority: 5}}, []string{"b", "c", "a"}},
+		{"fifo in priority", []task.HttpTask{{ID: "a"}, {ID: "b", Priority: 3}, {ID: "c"}, {ID: "d", Priority: 3}}, []string{"b", "d", "a", "c"}},
+	}
+	for _, c := range cases {
+		q := newWaitQueue(len(c.items))
+		for i := range c.items {
+			if !q.Push(&c.items[i], time.Millisecond) {
+				t.Fatalf("%s: Push(%s) = false", c.name, c.items[i].ID)
+			}
+		}
+		got := make([]string, 0, len(c.items))
+		for {
+			item, ok := q.Pop()
+			if !ok {
+				break
+			}
+			got = append(got, item.GetID())
+		}
+		if !equal(got, c.want) {
+			t.Errorf("%s: Pop order = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWaitQueueFull(t *testing.T) {
+	q := newWaitQueue(1)
+	if !q.Push(&task.HttpTask{ID: "a"}, time.Millisecond) {
+		t.Fatal("Push(a) = false")
+	}
+	select {
+	case <-q.Ready():
+	default:
+		t.Fatal("Ready() not signaled after Push")
+	}
+	if q.Push(&task.HttpTask{ID: "b"}, 10*time.Millisecond) {
+		t.Fatal("Push(b) on full queue = true")
+	}
+	//出队后等待中的入队成功
+	done := make(chan bool)
+	go func() {
+		done <- q.Push(&task.HttpTask{ID: "c"}, time.Second)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if item, ok := q.Pop(); !ok || item.GetID() != "a" {
+		t.Fatalf("Pop() = %v, %v, want a", item, ok)
+	}
+	if !<-done {
+		t.Fatal("Push(c) after Pop = false")
+	}
+	if n := q.Len(); n != 1 {
+		t.Errorf("Len() = %d, want 1", n)
+	}
+}
@@ -7,10 +7,14 @@ require (
 	github.com/go-redis/redis v6.15.6+incompatible
 	github.com/go-sql-driver/mysql v1.4.1
 	github.com/google/uuid v1.1.1
+	github.com/lib/pq v1.0.0
+	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/meixiu/httpclient v0.0.1
 	github.com/onsi/ginkgo v1.10.3 // indirect
 	github.com/onsi/gomega v1.7.1 // indirect
 	github.com/prometheus/client_golang v1.2.1
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/ugorji/go/codec v1.1.7
 	google.golang.org/appengine v1.6.5 // indirect
 	gopkg.in/yaml.v2 v2.2.4
 	xorm.io/xorm v0.8.0
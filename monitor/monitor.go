@@ -17,6 +17,8 @@ type ConsumerMonitor interface {
 	HandleTask(cid string, task task.Tasker)
 	// Retries retries task
 	Retries(cid string, task task.Tasker)
+	// DeadTask task moved to dead letter
+	DeadTask(cid string, task task.Tasker)
 }
 
 // ProducerMonitor producer monitorF
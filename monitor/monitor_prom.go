@@ -22,6 +22,8 @@ type PromMonitor struct {
 	HandleTaskDuration *prometheus.GaugeVec
 	// RetryTaskCounterVec retry
 	RetryTaskCounterVec *prometheus.CounterVec
+	// DeadTaskCounterVec dead letter
+	DeadTaskCounterVec *prometheus.CounterVec
 	// RequestCounterVer producer request num
 	RequestCounterVer *prometheus.CounterVec
 	// ResponseLatency producer latency
@@ -60,6 +62,12 @@ func NewPromStore(metrics ...prometheus.Collector) *PromMonitor {
 			Name:      "retry_task_total",
 			Help:      "retry task handler total",
 		}, []string{"appID", "sid", "cid", "type"}),
+		DeadTaskCounterVec: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "uTask",
+			Subsystem: "consumer",
+			Name:      "dead_task_total",
+			Help:      "dead letter task total",
+		}, []string{"appID", "sid", "cid", "type"}),
 		RequestCounterVer: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: "uTask",
 			Subsystem: "producer",
@@ -78,6 +86,7 @@ func NewPromStore(metrics ...prometheus.Collector) *PromMonitor {
 	prometheus.MustRegister(prom.HandleTaskCounterVec)
 	prometheus.MustRegister(prom.HandleTaskDuration)
 	prometheus.MustRegister(prom.RetryTaskCounterVec)
+	prometheus.MustRegister(prom.DeadTaskCounterVec)
 	prometheus.MustRegister(prom.RequestCounterVer)
 	prometheus.MustRegister(prom.ResponseLatency)
 	return prom
@@ -106,6 +115,11 @@ func (prom *PromMonitor) Retries(cid string, task task.Tasker) {
 	prom.RetryTaskCounterVec.WithLabelValues(task.GetAppID(), task.GetSID(), cid, task.GetType()).Inc()
 }
 
+// DeadTask consumer dead letter
+func (prom *PromMonitor) DeadTask(cid string, task task.Tasker) {
+	prom.DeadTaskCounterVec.WithLabelValues(task.GetAppID(), task.GetSID(), cid, task.GetType()).Inc()
+}
+
 // Request producer request
 func (prom *PromMonitor) Request(processType string) {
 	prom.RequestCounterVer.WithLabelValues(processType).Inc()
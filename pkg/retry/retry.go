@@ -0,0 +1,102 @@
+package retry
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	// Fixed 每次重试间隔Interval秒
+	Fixed = "fixed"
+	// Linear 第n次重试间隔n*Interval秒
+	Linear = "linear"
+	// Exponential 第n次重试间隔Interval*2^(n-1)秒
+	Exponential = "exponential"
+	// Custom 第n次重试间隔Intervals[n-1]秒, 超出后使用最后一个间隔
+	Custom = "custom"
+)
+
+// Policy 重试策略, Strategy为空时第n次重试间隔n*n秒
+type Policy struct {
+	Strategy    string  `json:"strategy" yaml:"strategy"`         // fixed|linear|exponential|custom
+	Interval    int64   `json:"interval" yaml:"interval"`         // 重试间隔(秒), linear和exponential为首次间隔
+	MaxInterval int64   `json:"max_interval" yaml:"max_interval"` // 最大重试间隔(秒), 0为不限制
+	Intervals   []int64 `json:"intervals" yaml:"intervals"`       // custom的重试间隔列表(秒)
+	Jitter      float64 `json:"jitter" yaml:"jitter"`             // 间隔的随机浮动比例 0-1, 如0.2为上下浮动20%
+	MaxTimes    int     `json:"max_times" yaml:"max_times"`       // 最大执行次数, 0为使用上级配置
+}
+
+// Validate 验证参数
+func (p Policy) Validate() error {
+	switch p.Strategy {
+	case "":
+	case Fixed, Linear, Exponential:
+		if p.Interval <= 0 {
+			return fmt.Errorf("incorrect parameter: %s", "retry.interval")
+		}
+	case Custom:
+		if len(p.Intervals) == 0 {
+			return fmt.Errorf("incorrect parameter: %s", "retry.intervals")
+		}
+		for _, v := range p.Intervals {
+			if v < 0 {
+				return fmt.Errorf("incorrect parameter: %s", "retry.intervals")
+			}
+		}
+	default:
+		return fmt.Errorf("incorrect parameter: %s", "retry.strategy")
+	}
+	if p.MaxInterval < 0 {
+		return fmt.Errorf("incorrect parameter: %s", "retry.max_interval")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("incorrect parameter: %s", "retry.jitter")
+	}
+	if p.MaxTimes < 0 {
+		return fmt.Errorf("incorrect parameter: %s", "retry.max_times")
+	}
+	return nil
+}
+
+// Delay 返回第times次重试前等待的秒数
+func (p Policy) Delay(times int64) int64 {
+	if times < 1 {
+		times = 1
+	}
+	var d int64
+	switch p.Strategy {
+	case Fixed:
+		d = p.Interval
+	case Linear:
+		d = p.Interval * times
+	case Exponential:
+		d = p.Interval
+		for i := int64(1); i < times && (p.MaxInterval <= 0 || d < p.MaxInterval); i++ {
+			if d > 1<<40 { //防止溢出
+				break
+			}
+			d *= 2
+		}
+	case Custom:
+		if len(p.Intervals) == 0 {
+			d = times * times
+			break
+		}
+		if times > int64(len(p.Intervals)) {
+			times = int64(len(p.Intervals))
+		}
+		d = p.Intervals[times-1]
+	default:
+		d = times * times
+	}
+	if p.MaxInterval > 0 && d > p.MaxInterval {
+		d = p.MaxInterval
+	}
+	if p.Jitter > 0 && d > 0 {
+		d += int64(float64(d) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
@@ -0,0 +1,64 @@
+package retry
+
+import "testing"
+
+func TestPolicyDelay(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy Policy
+		times  int64
+		want   int64
+	}{
+		{"default first", Policy{}, 1, 1},
+		{"default third", Policy{}, 3, 9},
+		{"default zero times", Policy{}, 0, 1},
+		{"fixed", Policy{Strategy: Fixed, Interval: 5}, 4, 5},
+		{"linear", Policy{Strategy: Linear, Interval: 5}, 4, 20},
+		{"exponential first", Policy{Strategy: Exponential, Interval: 5}, 1, 5},
+		{"exponential fourth", Policy{Strategy: Exponential, Interval: 5}, 4, 40},
+		{"exponential capped", Policy{Strategy: Exponential, Interval: 5, MaxInterval: 30}, 4, 30},
+		{"exponential overflow", Policy{Strategy: Exponential, Interval: 1}, 200, 1 << 41},
+		{"custom", Policy{Strategy: Custom, Intervals: []int64{1, 10, 60}}, 2, 10},
+		{"custom past end", Policy{Strategy: Custom, Intervals: []int64{1, 10, 60}}, 9, 60},
+		{"custom empty", Policy{Strategy: Custom}, 3, 9},
+		{"linear capped", Policy{Strategy: Linear, Interval: 10, MaxInterval: 25}, 3, 25},
+	}
+	for _, c := range cases {
+		if got := c.policy.Delay(c.times); got != c.want {
+			t.Errorf("%s: Delay(%d) = %d, want %d", c.name, c.times, got, c.want)
+		}
+	}
+}
+
+func TestPolicyDelayJitter(t *testing.T) {
+	p := Policy{Strategy: Fixed, Interval: 100, Jitter: 0.2}
+	for i := 0; i < 1000; i++ {
+		if d := p.Delay(1); d < 80 || d > 120 {
+			t.Fatalf("Delay(1) = %d, want 80-120", d)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy Policy
+		ok     bool
+	}{
+		{"empty", Policy{}, true},
+		{"fixed", Policy{Strategy: Fixed, Interval: 1}, true},
+		{"fixed without interval", Policy{Strategy: Fixed}, false},
+		{"custom", Policy{Strategy: Custom, Intervals: []int64{0, 5}}, true},
+		{"custom without intervals", Policy{Strategy: Custom}, false},
+		{"custom negative interval", Policy{Strategy: Custom, Intervals: []int64{-1}}, false},
+		{"unknown strategy", Policy{Strategy: "random"}, false},
+		{"negative max interval", Policy{MaxInterval: -1}, false},
+		{"jitter too large", Policy{Jitter: 1.5}, false},
+		{"negative max times", Policy{MaxTimes: -1}, false},
+	}
+	for _, c := range cases {
+		if err := c.policy.Validate(); (err == nil) != c.ok {
+			t.Errorf("%s: Validate() = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
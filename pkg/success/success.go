@@ -0,0 +1,170 @@
+package success
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Envelope 响应内容为{"code": 0, "message": ""}且code等于0时成功, 不检查状态码
+	Envelope = "envelope"
+	// Any2xx 状态码为2xx时成功
+	Any2xx = "2xx"
+	// Status 状态码在Status范围内时成功
+	Status = "status"
+	// JSON 状态码为2xx且响应内容在Path的值等于Value时成功
+	JSON = "json"
+)
+
+// Rule 任务执行成功的判断规则, Mode为空时为Envelope
+// 失败时状态码在Permanent范围内为永久失败, 不再重试; 其他失败按重试策略重试
+type Rule struct {
+	Mode      string   `json:"mode" yaml:"mode"`           // envelope|2xx|status|json
+	Status    []string `json:"status" yaml:"status"`       // status的成功状态码范围, 如: "200-299", "3xx", "404"
+	Path      string   `json:"path" yaml:"path"`           // json的取值路径, 点号分隔, 数组用下标, 如: "data.items.0.ok"
+	Value     string   `json:"value" yaml:"value"`         // json的期望值, 与字符串值或JSON文本比较, 如: "0", "true", "ok"
+	Permanent []string `json:"permanent" yaml:"permanent"` // 永久失败的状态码范围, 如: "400-499"
+}
+
+// Validate 验证参数
+func (r Rule) Validate() error {
+	switch r.Mode {
+	case "", Envelope, Any2xx:
+	case Status:
+		if len(r.Status) == 0 {
+			return fmt.Errorf("incorrect parameter: %s", "success.status")
+		}
+	case JSON:
+		if r.Path == "" {
+			return fmt.Errorf("incorrect parameter: %s", "success.path")
+		}
+	default:
+		return fmt.Errorf("incorrect parameter: %s", "success.mode")
+	}
+	for _, v := range r.Status {
+		if _, _, err := parseRange(v); err != nil {
+			return fmt.Errorf("incorrect parameter: success.status, %w", err)
+		}
+	}
+	for _, v := range r.Permanent {
+		if _, _, err := parseRange(v); err != nil {
+			return fmt.Errorf("incorrect parameter: success.permanent, %w", err)
+		}
+	}
+	return nil
+}
+
+// Check 判断响应是否成功, 失败时返回原因
+func (r Rule) Check(status int, body []byte) error {
+	switch r.Mode {
+	case Any2xx:
+		return check2xx(status)
+	case Status:
+		if !inRanges(status, r.Status) {
+			return fmt.Errorf("status=%d", status)
+		}
+		return nil
+	case JSON:
+		if err := check2xx(status); err != nil {
+			return err
+		}
+		return r.checkJSON(body)
+	default:
+		res := &struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}{}
+		if err := json.Unmarshal(body, res); err != nil {
+			return err
+		}
+		// 错误码不等于0时表示失败
+		if res.Code != 0 {
+			return fmt.Errorf("code=%d error=%s", res.Code, res.Message)
+		}
+		return nil
+	}
+}
+
+// IsPermanent 判断状态码是否为永久失败
+func (r Rule) IsPermanent(status int) bool {
+	return inRanges(status, r.Permanent)
+}
+
+// checkJSON 判断响应内容在Path的值是否等于Value
+func (r Rule) checkJSON(body []byte) error {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	for _, key := range strings.Split(r.Path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return fmt.Errorf("path=%s not found", r.Path)
+			}
+			v = node[i]
+		default:
+			return fmt.Errorf("path=%s not found", r.Path)
+		}
+	}
+	if s, ok := v.(string); ok && s == r.Value {
+		return nil
+	}
+	if b, _ := json.Marshal(v); string(b) == r.Value {
+		return nil
+	}
+	b, _ := json.Marshal(v)
+	return fmt.Errorf("path=%s value=%s", r.Path, b)
+}
+
+// check2xx 判断状态码是否为2xx
+func check2xx(status int) error {
+	if status < 200 || status > 299 {
+		return fmt.Errorf("status=%d", status)
+	}
+	return nil
+}
+
+// inRanges 判断状态码是否在任一范围内
+func inRanges(status int, ranges []string) bool {
+	for _, v := range ranges {
+		lo, hi, err := parseRange(v)
+		if err == nil && status >= lo && status <= hi {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange 解析状态码范围: "200-299"、"2xx"或单个状态码
+func parseRange(s string) (int, int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+		lo := int(s[0]-'0') * 100
+		return lo, lo + 99, nil
+	}
+	parts := strings.SplitN(s, "-", 2)
+	lo, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, errors.New("bad status range " + s)
+	}
+	hi := lo
+	if len(parts) == 2 {
+		if hi, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return 0, 0, errors.New("bad status range " + s)
+		}
+	}
+	if lo < 100 || hi > 599 || lo > hi {
+		return 0, 0, errors.New("bad status range " + s)
+	}
+	return lo, hi, nil
+}
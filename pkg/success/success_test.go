@@ -0,0 +1,101 @@
+package success
+
+import "testing"
+
+func TestRuleCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		rule   Rule
+		status int
+		body   string
+		ok     bool
+	}{
+		{"envelope ok", Rule{}, 200, `{"code": 0, "message": ""}`, true},
+		{"envelope ignores status", Rule{Mode: Envelope}, 500, `{"code": 0}`, true},
+		{"envelope error code", Rule{}, 200, `{"code": 1, "message": "fail"}`, false},
+		{"envelope not json", Rule{}, 200, `ok`, false},
+		{"2xx ok", Rule{Mode: Any2xx}, 204, ``, true},
+		{"2xx redirect", Rule{Mode: Any2xx}, 302, ``, false},
+		{"status range", Rule{Mode: Status, Status: []string{"200-299", "302"}}, 302, ``, true},
+		{"status class", Rule{Mode: Status, Status: []string{"4xx"}}, 404, ``, true},
+		{"status miss", Rule{Mode: Status, Status: []string{"200"}}, 201, ``, false},
+		{"json string", Rule{Mode: JSON, Path: "data.result", Value: "ok"}, 200, `{"data": {"result": "ok"}}`, true},
+		{"json number", Rule{Mode: JSON, Path: "code", Value: "0"}, 200, `{"code": 0}`, true},
+		{"json bool", Rule{Mode: JSON, Path: "ok", Value: "true"}, 200, `{"ok": true}`, true},
+		{"json array index", Rule{Mode: JSON, Path: "items.1.ok", Value: "yes"}, 200, `{"items": [{"ok": "no"}, {"ok": "yes"}]}`, true},
+		{"json index out of range", Rule{Mode: JSON, Path: "items.2", Value: "yes"}, 200, `{"items": []}`, false},
+		{"json wrong value", Rule{Mode: JSON, Path: "data.result", Value: "ok"}, 200, `{"data": {"result": "fail"}}`, false},
+		{"json missing path", Rule{Mode: JSON, Path: "data.result", Value: "ok"}, 200, `{"data": "ok"}`, false},
+		{"json bad status", Rule{Mode: JSON, Path: "ok", Value: "true"}, 500, `{"ok": true}`, false},
+	}
+	for _, c := range cases {
+		if err := c.rule.Check(c.status, []byte(c.body)); (err == nil) != c.ok {
+			t.Errorf("%s: Check(%d, %s) = %v, want ok %v", c.name, c.status, c.body, err, c.ok)
+		}
+	}
+}
+
+func TestRuleIsPermanent(t *testing.T) {
+	r := Rule{Permanent: []string{"400-403", "410"}}
+	cases := []struct {
+		status int
+		want   bool
+	}{
+		{400, true},
+		{403, true},
+		{404, false},
+		{410, true},
+		{500, false},
+	}
+	for _, c := range cases {
+		if got := r.IsPermanent(c.status); got != c.want {
+			t.Errorf("IsPermanent(%d) = %v, want %v", c.status, got, c.want)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		in     string
+		lo, hi int
+		ok     bool
+	}{
+		{"2xx", 200, 299, true},
+		{" 5XX ", 500, 599, true},
+		{"200-299", 200, 299, true},
+		{"200 - 204", 200, 204, true},
+		{"404", 404, 404, true},
+		{"6xx", 0, 0, false},
+		{"299-200", 0, 0, false},
+		{"99", 0, 0, false},
+		{"200-600", 0, 0, false},
+		{"abc", 0, 0, false},
+		{"200-", 0, 0, false},
+	}
+	for _, c := range cases {
+		lo, hi, err := parseRange(c.in)
+		if (err == nil) != c.ok || lo != c.lo || hi != c.hi {
+			t.Errorf("parseRange(%q) = %d, %d, %v, want %d, %d, ok %v", c.in, lo, hi, err, c.lo, c.hi, c.ok)
+		}
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		rule Rule
+		ok   bool
+	}{
+		{"empty", Rule{}, true},
+		{"status without ranges", Rule{Mode: Status}, false},
+		{"json without path", Rule{Mode: JSON}, false},
+		{"unknown mode", Rule{Mode: "xml"}, false},
+		{"bad permanent", Rule{Permanent: []string{"4x"}}, false},
+		{"status", Rule{Mode: Status, Status: []string{"2xx"}, Permanent: []string{"400-499"}}, true},
+	}
+	for _, c := range cases {
+		if err := c.rule.Validate(); (err == nil) != c.ok {
+			t.Errorf("%s: Validate() = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/meixiu/utask/store"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	MissedSkip    = "skip"    // 错过的执行全部跳过
+	MissedOnce    = "once"    // 错过的执行合并为一次
+	MissedCatchup = "catchup" // 错过的执行逐个补上
+)
+
+var (
+	// MissedTime 超过执行时间多久视为错过
+	MissedTime = time.Minute
+	// MaxCatchup 单次最多补上的执行次数, 更早的执行跳过
+	MaxCatchup = 100
+)
+
+// Parse 解析标准cron表达式(5段, 支持@daily、@every 1h等), tz为IANA时区名, 为空时使用本地时区
+func Parse(spec, tz string) (cron.Schedule, error) {
+	loc := time.Local
+	if tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect parameter: timezone")
+		}
+		loc = l
+	}
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect parameter: cron, %v", err)
+	}
+	return zoned{sched, loc}, nil
+}
+
+// zoned 在指定时区计算执行时间
+type zoned struct {
+	cron.Schedule
+	loc *time.Location
+}
+
+func (z zoned) Next(t time.Time) time.Time {
+	return z.Schedule.Next(t.In(z.loc))
+}
+
+// Next 返回计划在after之后的下次执行时间戳, 没有下次执行时返回0
+func Next(spec, tz string, after time.Time) (int64, error) {
+	sched, err := Parse(spec, tz)
+	if err != nil {
+		return 0, err
+	}
+	return unix(sched.Next(after)), nil
+}
+
+// IsMissed 校验错过执行的处理方式
+func IsMissed(missed string) bool {
+	switch missed {
+	case MissedSkip, MissedOnce, MissedCatchup:
+		return true
+	}
+	return false
+}
+
+// Runs 按错过执行的处理方式返回计划在now之前应执行的时间, 以及之后的下次执行时间
+func Runs(sc *store.TaskSchedule, now time.Time) ([]int64, int64, error) {
+	sched, err := Parse(sc.Cron, sc.Timezone)
+	if err != nil {
+		return nil, 0, err
+	}
+	runs := make([]int64, 0, 1)
+	at := time.Unix(sc.NextTime, 0)
+	for !at.IsZero() && !at.After(now) && len(runs) < MaxCatchup {
+		runs = append(runs, at.Unix())
+		at = sched.Next(at)
+	}
+	if !at.IsZero() && !at.After(now) {
+		//超过补执行上限, 从now开始计算
+		at = sched.Next(now)
+	}
+	//按执行时间拆分为错过的和按时的
+	deadline := now.Add(-MissedTime).Unix()
+	i := 0
+	for i < len(runs) && runs[i] < deadline {
+		i++
+	}
+	missed, onTime := runs[:i], runs[i:]
+	switch sc.Missed {
+	case MissedCatchup:
+	case MissedOnce:
+		if len(missed) > 0 && len(onTime) == 0 {
+			runs = missed[len(missed)-1:]
+		} else {
+			runs = onTime
+		}
+	default:
+		runs = onTime
+	}
+	return runs, unix(at), nil
+}
+
+// unix 返回时间戳, 零值时间返回0
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
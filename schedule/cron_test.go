@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meixiu/utask/store"
+)
+
+func TestRuns(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	at := func(h, m int) int64 {
+		return time.Date(2024, 1, 1, h, m, 0, 0, time.UTC).Unix()
+	}
+	cases := []struct {
+		name   string
+		cron   string
+		missed string
+		next   int64
+		runs   []int64
+		after  int64
+	}{
+		{"not due", "0 * * * *", MissedSkip, at(13, 0), nil, at(13, 0)},
+		{"on time", "0 * * * *", MissedSkip, at(12, 0), []int64{at(12, 0)}, at(13, 0)},
+		{"skip missed", "*/5 * * * *", MissedSkip, at(11, 50), []int64{at(12, 0)}, at(12, 5)},
+		{"catchup missed", "*/5 * * * *", MissedCatchup, at(11, 50), []int64{at(11, 50), at(11, 55), at(12, 0)}, at(12, 5)},
+		{"once with on time", "*/5 * * * *", MissedOnce, at(11, 50), []int64{at(12, 0)}, at(12, 5)},
+		{"once without on time", "0 1-23/2 * * *", MissedOnce, at(7, 0), []int64{at(11, 0)}, at(13, 0)},
+		{"skip without on time", "0 1-23/2 * * *", MissedSkip, at(7, 0), nil, at(13, 0)},
+		{"catchup limit", "* * * * *", MissedCatchup, at(9, 0), nil, at(12, 1)},
+	}
+	for _, c := range cases {
+		runs, next, err := Runs(&store.TaskSchedule{Cron: c.cron, Timezone: "UTC", Missed: c.missed, NextTime: c.next}, now)
+		if err != nil {
+			t.Fatalf("%s: Runs() err: %v", c.name, err)
+		}
+		if c.name == "catchup limit" {
+			if len(runs) != MaxCatchup || runs[0] != at(9, 0) {
+				t.Errorf("%s: Runs() = %d runs from %d, want %d from %d", c.name, len(runs), runs[0], MaxCatchup, at(9, 0))
+			}
+		} else if !equal(runs, c.runs) {
+			t.Errorf("%s: Runs() = %v, want %v", c.name, runs, c.runs)
+		}
+		if next != c.after {
+			t.Errorf("%s: Runs() next = %d, want %d", c.name, next, c.after)
+		}
+	}
+}
+
+func TestNextTimezone(t *testing.T) {
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	next, err := Next("0 9 * * *", "Asia/Shanghai", after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC).Unix(); next != want {
+		t.Errorf("Next() = %d, want %d", next, want)
+	}
+	if _, err := Next("0 9 * * *", "Mars/Olympus", after); err == nil {
+		t.Error("Next() with unknown timezone err = nil")
+	}
+	if _, err := Next("61 * * * *", "", after); err == nil {
+		t.Error("Next() with bad cron err = nil")
+	}
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
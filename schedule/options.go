@@ -0,0 +1,52 @@
+package schedule
+
+import (
+	"github.com/meixiu/utask/store"
+)
+
+// Options option info
+type Options struct {
+	TaskStore     store.TaskStorer
+	ScheduleStore store.ScheduleStorer
+	LeaderStore   store.LeaderStorer
+}
+
+// Option Option
+type Option func(*Options)
+
+// NewOptions construct
+func NewOptions(opts ...Option) Options {
+	opt := Options{
+		TaskStore:   store.DefaultRedisStore,
+		LeaderStore: store.DefaultRedisStore,
+	}
+	//计划区使用任务处理区的数据库
+	if s, ok := store.DefaultDbStore.(store.ScheduleStorer); ok {
+		opt.ScheduleStore = s
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	return opt
+}
+
+// TaskStore task store
+func TaskStore(t store.TaskStorer) Option {
+	return func(o *Options) {
+		o.TaskStore = t
+	}
+}
+
+// ScheduleStore schedule store
+func ScheduleStore(s store.ScheduleStorer) Option {
+	return func(o *Options) {
+		o.ScheduleStore = s
+	}
+}
+
+// LeaderStore leader store
+func LeaderStore(l store.LeaderStorer) Option {
+	return func(o *Options) {
+		o.LeaderStore = l
+	}
+}
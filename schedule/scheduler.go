@@ -0,0 +1,171 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/meixiu/utask/log"
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+)
+
+const (
+	//执行者选举名
+	LeaderName = "schedule"
+	//单次处理的到期计划数
+	DueScheduleSize = 100
+	//计划每次执行的幂等键保留时间, 推送成功但推进失败的执行在此时间内不会重复推送
+	RunIdempotencyWindow = 24 * time.Hour
+)
+
+// Scheduler 周期任务调度器
+// 每个节点都可以启动, 只有当选的执行者将到期的计划生成任务推送到任务数据源
+type Scheduler struct {
+	id       string        // 调度器唯一标志
+	interval time.Duration // 检查到期计划的间隔
+	term     time.Duration // 执行者任期
+
+	taskStore     store.TaskStorer     // 任务数据源
+	scheduleStore store.ScheduleStorer // 计划区
+	leaderStore   store.LeaderStorer   // 执行者选举
+
+	stop chan struct{} // 停止信号
+	done chan struct{} // 已停止信号
+}
+
+// NewScheduler 返回一个周期任务调度器
+func NewScheduler(id string, opts Options) *Scheduler {
+	return &Scheduler{
+		id:       id,
+		interval: time.Second,
+		term:     10 * time.Second,
+
+		taskStore:     opts.TaskStore,
+		scheduleStore: opts.ScheduleStore,
+		leaderStore:   opts.LeaderStore,
+
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Start 开始调度, 只能开始一次
+func (s *Scheduler) Start() error {
+	defer close(s.done)
+	if s.scheduleStore == nil || s.leaderStore == nil {
+		log.Info("scheduler disabled")
+		<-s.stop
+		return nil
+	}
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			log.Info("scheduler stopped")
+			return nil
+		case <-t.C:
+			if _, err := s.Materialize(); err != nil {
+				log.Error("scheduler materialize err: ", err)
+			}
+		}
+	}
+}
+
+// Stop 停止调度, 只能停止一次
+func (s *Scheduler) Stop(ctx context.Context) error {
+	close(s.stop)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Materialize 当选执行者时将到期的计划生成任务, 返回生成的任务数
+func (s *Scheduler) Materialize() (count int, err error) {
+	ok, err := s.leaderStore.Elect(LeaderName, s.id, s.term)
+	if err != nil || !ok {
+		return 0, err
+	}
+	now := time.Now()
+	items, err := s.scheduleStore.DueSchedules(now.Unix(), DueScheduleSize)
+	if err != nil {
+		return 0, err
+	}
+	for i := range items {
+		sc := &items[i]
+		runs, next, err := Runs(sc, now)
+		if err != nil {
+			log.Error("schedule runs err, schedule: ", sc.ScheduleID, " err: ", err)
+			continue
+		}
+		//先推送再推进下次执行时间, 推送失败时停在失败的执行时间, 下次检查时重试
+		pushed := 0
+		for _, at := range runs {
+			if err := s.push(sc, at); err != nil {
+				log.Error("schedule push err, schedule: ", sc.ScheduleID, " at: ", at, " err: ", err)
+				break
+			}
+			pushed++
+		}
+		count += pushed
+		last := sc.LastTime
+		if pushed > 0 {
+			last = runs[pushed-1]
+		}
+		if pushed < len(runs) {
+			next = runs[pushed]
+		}
+		if next == sc.NextTime {
+			continue
+		}
+		if _, err := s.scheduleStore.AdvanceSchedule(sc.ScheduleID, sc.NextTime, next, last); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// push 按计划的任务模板生成一个在at执行的任务
+// 同一计划同一执行时间只推送一次, 推进下次执行时间失败后重复的执行直接跳过
+func (s *Scheduler) push(sc *store.TaskSchedule, at int64) error {
+	item, err := store.Decode(sc.Template)
+	if err != nil {
+		return err
+	}
+	if err := store.PatchTask(item, task.Patch{ExpectTime: &at}); err != nil {
+		return err
+	}
+	item.Init(s.id)
+	is, ok := s.taskStore.(store.IdempotentStorer)
+	key := fmt.Sprintf("schedule:%s:%d", sc.ScheduleID, at)
+	if ok {
+		tid, reserved, err := is.Reserve(item.GetAppID(), key, item.GetID(), RunIdempotencyWindow)
+		if err != nil {
+			return err
+		}
+		if !reserved {
+			log.Info("schedule push duplicated: ", sc.ScheduleID, " task: ", tid, " at: ", at)
+			return nil
+		}
+	}
+	pushed, err := s.taskStore.RPush(item)
+	if err == nil && !pushed {
+		err = errors.New("add queue error")
+	}
+	if err != nil {
+		if ok {
+			//推送失败时解除绑定, 允许下次重试
+			if forgetErr := is.Forget(item.GetAppID(), key, item.GetID()); forgetErr != nil {
+				log.Error("schedule forget err, schedule: ", sc.ScheduleID, " err: ", forgetErr)
+			}
+		}
+		return err
+	}
+	log.Info("schedule push: ", sc.ScheduleID, " task: ", item.GetID(), " at: ", at)
+	return nil
+}
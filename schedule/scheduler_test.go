@@ -0,0 +1,88 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/store/memory"
+	"github.com/meixiu/utask/task"
+)
+
+// flakyStore 推送limit个任务后推送失败的任务数据源, limit小于0时不限制
+type flakyStore struct {
+	*memory.Store
+	limit int
+}
+
+func (s *flakyStore) RPush(item task.Tasker) (bool, error) {
+	if s.limit == 0 {
+		return false, errors.New("push failed")
+	}
+	s.limit--
+	return s.Store.RPush(item)
+}
+
+func TestMaterialize(t *testing.T) {
+	m := memory.NewStore()
+	ts := &flakyStore{Store: m, limit: 1}
+	s := NewScheduler("test", NewOptions(TaskStore(ts), ScheduleStore(m), LeaderStore(m)))
+
+	b, err := store.Encode(&task.HttpTask{AppID: "100", URL: "http://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//避免测试期间跨过整分钟
+	if time.Now().Second() >= 58 {
+		time.Sleep(3 * time.Second)
+	}
+	minute := time.Now().Truncate(time.Minute).Unix()
+	runs := []int64{minute - 120, minute - 60, minute}
+	if err := m.AddSchedule(&store.TaskSchedule{ScheduleID: "s1", AppID: "100", Cron: "* * * * *",
+		Type: "http", Template: b, Missed: MissedCatchup, NextTime: runs[0]}); err != nil {
+		t.Fatal(err)
+	}
+	queued := func() int {
+		n := 0
+		for {
+			item, _ := m.LPop()
+			if item == nil {
+				return n
+			}
+			n++
+		}
+	}
+
+	//第二次推送失败, 下次执行时间停在失败的执行
+	if count, err := s.Materialize(); err != nil || count != 1 {
+		t.Fatalf("Materialize() = %d, %v, want 1", count, err)
+	}
+	sc, _ := m.GetSchedule("s1")
+	if sc.NextTime != runs[1] || sc.LastTime != runs[0] {
+		t.Fatalf("after failed push next = %d, last = %d, want %d, %d", sc.NextTime, sc.LastTime, runs[1], runs[0])
+	}
+
+	ts.limit = -1
+	if count, err := s.Materialize(); err != nil || count != 2 {
+		t.Fatalf("Materialize() retry = %d, %v, want 2", count, err)
+	}
+	sc, _ = m.GetSchedule("s1")
+	if sc.NextTime <= runs[2] || sc.LastTime != runs[2] {
+		t.Errorf("after retry next = %d, last = %d", sc.NextTime, sc.LastTime)
+	}
+	if n := queued(); n != 3 {
+		t.Fatalf("queued = %d, want 3", n)
+	}
+
+	//推进失败后重新生成的执行不会重复推送
+	if _, err := m.AdvanceSchedule("s1", sc.NextTime, runs[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Materialize(); err != nil {
+		t.Fatal(err)
+	}
+	if n := queued(); n != 0 {
+		t.Errorf("queued after replay = %d, want 0", n)
+	}
+}
@@ -6,6 +6,12 @@ type Pusher interface {
 	Register(appId string, appSecret string)
 	// Push 推送一个任务
 	Push(task interface{}) (taskId string, err error)
+	// PushBatch 批量推送任务, 按BatchSize自动分批; 结果与tasks一一对应
+	PushBatch(tasks []interface{}) (results []PushResult, err error)
+	// Status 查询任务状态
+	Status(taskId string) (status *TaskStatus, err error)
+	// Cancel 取消一个未开始执行的任务, 任务已开始执行或不存在时返回false
+	Cancel(taskId string) (cancelled bool, err error)
 }
 
 // Checker 任务认证检查接口
@@ -1,26 +1,122 @@
 package sdk
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/meixiu/httpclient"
 )
 
 const (
-	PushPath  = "/api/task/http" // 任务推送接口
-	CheckPath = "/api/check"     // 任务认证接口
+	PushPath   = "/api/task/http"  // 任务推送接口
+	BatchPath  = "/api/tasks/http" // 任务批量推送接口
+	StatusPath = "/api/task/"      // 任务状态接口, DELETE请求为任务取消接口
+	CheckPath  = "/api/check"      // 任务认证接口
+)
+
+const (
+	UniqueDrop    = "drop"    // 已有同键待执行任务时丢弃新任务
+	UniqueReplace = "replace" // 用新任务的执行时间和内容替换待执行任务
+	UniqueExtend  = "extend"  // 将待执行任务延后到新任务的执行时间
+)
+
+const (
+	ContentJSON   = "json"   // body为JSON原文
+	ContentForm   = "form"   // body为JSON对象, 按form-urlencoded编码发送
+	ContentText   = "text"   // body为纯文本原文
+	ContentXML    = "xml"    // body为XML原文
+	ContentBinary = "binary" // body为base64编码的二进制内容, 解码后发送
+)
+
+const (
+	SuccessEnvelope = "envelope" // 响应内容为{"code": 0}时成功
+	SuccessAny2xx   = "2xx"      // 状态码为2xx时成功
+	SuccessStatus   = "status"   // 状态码在Status范围内时成功
+	SuccessJSON     = "json"     // 状态码为2xx且响应内容在Path的值等于Value时成功
+)
+
+const (
+	RetryFixed       = "fixed"       // 每次重试间隔Interval秒
+	RetryLinear      = "linear"      // 第n次重试间隔n*Interval秒
+	RetryExponential = "exponential" // 第n次重试间隔Interval*2^(n-1)秒, 不超过MaxInterval
+	RetryCustom      = "custom"      // 第n次重试间隔Intervals[n-1]秒
 )
 
 type (
 	// HttpPushReq HTTP任务请求参数
 	HttpPushReq struct {
 		ExpectTime  int64  `json:"expect_time"`  // 等于0:立即执行; 小于一年:延时执行; 其他值:定时执行
+		Priority    int    `json:"priority"`     // 优先级 0-9, 越大越优先
 		AppID       string `json:"app_id"`       // 业务ID
 		URL         string `json:"url"`          // 请求地址
-		Method      string `json:"method"`       // GET|POST
-		ContentType string `json:"content_type"` // 默认为JSON
-		Body        string `json:"body"`         // 请求原数据
+		Method      string `json:"method"`       // GET|POST|PUT|PATCH|DELETE, 默认为GET
+		ContentType string `json:"content_type"` // ContentJSON|ContentForm|ContentText|ContentXML|ContentBinary, 默认为JSON
+		Body        string `json:"body"`         // 请求原数据, ContentForm为JSON对象, ContentBinary为base64编码
+
+		Headers map[string]string `json:"headers,omitempty"` // 请求头, 不能覆盖U-Task-Id和U-Task-Token
+		Query   map[string]string `json:"query,omitempty"`   // 查询参数, 追加到请求地址
+
+		IdempotencyKey string `json:"idempotency_key,omitempty"` // 幂等键, 去重窗口内重复推送返回原任务ID
+		UniqueKey      string `json:"unique_key,omitempty"`      // 唯一键, 同一业务同一时间只有一个待执行任务
+		UniquePolicy   string `json:"unique_policy,omitempty"`   // 已有同键待执行任务时的策略: UniqueDrop|UniqueReplace|UniqueExtend
+
+		OnSuccessURL string `json:"on_success_url,omitempty"` // 执行成功后POST回调地址
+		OnFailureURL string `json:"on_failure_url,omitempty"` // 重试耗尽成为死信后POST回调地址
+
+		Retry   *RetryPolicy `json:"retry,omitempty"`   // 重试策略, 为空时使用业务或全局的重试策略
+		Timeout int64        `json:"timeout,omitempty"` // 执行超时时间(秒), 默认300, 不能超过服务端server.max_timeout
+		Success *SuccessRule `json:"success,omitempty"` // 成功判断规则, 为空时使用业务或全局的规则
+	}
+
+	// SuccessRule 成功判断规则, Mode为空时为SuccessEnvelope
+	SuccessRule struct {
+		Mode      string   `json:"mode"`                // SuccessEnvelope|SuccessAny2xx|SuccessStatus|SuccessJSON
+		Status    []string `json:"status,omitempty"`    // SuccessStatus的成功状态码范围, 如: "200-299", "3xx", "404"
+		Path      string   `json:"path,omitempty"`      // SuccessJSON的取值路径, 点号分隔, 数组用下标
+		Value     string   `json:"value,omitempty"`     // SuccessJSON的期望值
+		Permanent []string `json:"permanent,omitempty"` // 永久失败不再重试的状态码范围, 如: "400-499"
+	}
+
+	// RetryPolicy 重试策略, Strategy为空时第n次重试间隔n*n秒
+	RetryPolicy struct {
+		Strategy    string  `json:"strategy"`               // RetryFixed|RetryLinear|RetryExponential|RetryCustom
+		Interval    int64   `json:"interval,omitempty"`     // 重试间隔(秒), linear和exponential为首次间隔
+		MaxInterval int64   `json:"max_interval,omitempty"` // 最大重试间隔(秒)
+		Intervals   []int64 `json:"intervals,omitempty"`    // custom的重试间隔列表(秒), 超出后使用最后一个间隔
+		Jitter      float64 `json:"jitter,omitempty"`       // 间隔的随机浮动比例 0-1
+		MaxTimes    int     `json:"max_times,omitempty"`    // 最大执行次数
+	}
+
+	// HttpCallback 回调请求内容, 可用请求头中的U-Task-Id和U-Task-Token调用HttpCheck.Check校验来源
+	HttpCallback struct {
+		TaskId string `json:"task_id"`
+		AppID  string `json:"app_id"`
+		Status string `json:"status"` // succeeded|failed
+		Result string `json:"result"` // 最后一次执行结果
+		Error  string `json:"error"`  // 失败原因
+		Times  int64  `json:"times"`  // 执行次数
+	}
+
+	// PushResult 批量推送中单个任务的结果, Error不为空时推送失败
+	PushResult struct {
+		TaskId     string `json:"task_id"`
+		Duplicated bool   `json:"duplicated"` // 幂等键重复, TaskId为原任务ID
+		Unique     string `json:"unique"`     // 已有同唯一键的待执行任务时执行的策略, TaskId为已有任务ID
+		Error      string `json:"error"`
+	}
+
+	// HttpBatchResp HTTP任务批量推送返回参数
+	HttpBatchResp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Items     []PushResult `json:"items"`
+			Succeeded int          `json:"succeeded"`
+			Failed    int          `json:"failed"`
+		} `json:"data"`
 	}
 
 	// HttpCheckReq HTTP任务认证参数
@@ -34,7 +130,50 @@ type (
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 		Data    struct {
-			TaskId string `json:"task_id"`
+			TaskId     string `json:"task_id"`
+			Duplicated bool   `json:"duplicated"`
+			Unique     string `json:"unique"`
+		} `json:"data"`
+	}
+
+	// TaskStatus 任务状态
+	TaskStatus struct {
+		TaskId     string        `json:"task_id"`
+		AppID      string        `json:"app_id"`
+		State      string        `json:"state"`     // queued|scheduled|running|retrying|succeeded|dead|unknown
+		Times      int64         `json:"times"`     // 执行失败次数
+		MaxTimes   int64         `json:"max_times"` // 最大执行次数
+		NextTime   int64         `json:"next_time"` // 下次执行时间, 等待重试时为按重试策略计算的时间
+		LastResult string        `json:"last_result"`
+		LastError  string        `json:"last_error"`
+		History    []TaskAttempt `json:"history"` // 每次执行记录
+	}
+
+	// TaskAttempt 任务的一次执行记录
+	TaskAttempt struct {
+		Times      int64  `json:"times"`
+		Status     int    `json:"status"` // 1:成功; 0:失败
+		Result     string `json:"result"`
+		Error      string `json:"error"`
+		ExecTime   int64  `json:"exec_time"` // 执行花费时间(毫秒)
+		CreateTime int64  `json:"create_time"`
+	}
+
+	// HttpStatusResp HTTP任务状态返回参数
+	HttpStatusResp struct {
+		Code    int        `json:"code"`
+		Message string     `json:"message"`
+		Data    TaskStatus `json:"data"`
+	}
+
+	// HttpCancelResp HTTP任务取消返回参数
+	HttpCancelResp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			TaskId    string `json:"task_id"`
+			Cancelled bool   `json:"cancelled"`
+			State     string `json:"state"` // cancelled|running|not_found
 		} `json:"data"`
 	}
 
@@ -46,6 +185,9 @@ type (
 	}
 )
 
+// BatchSize PushBatch单次请求的最大任务数, 不能超过服务端server.max_batch
+var BatchSize = 500
+
 // NewHttpPush
 func NewHttpPush(url string) *HttpPush {
 	url = strings.TrimSuffix(url, "/")
@@ -81,6 +223,84 @@ func (h *HttpPush) Push(task interface{}) (string, error) {
 	return data.Data.TaskId, nil
 }
 
+func (h *HttpPush) PushBatch(tasks []interface{}) ([]PushResult, error) {
+	results := make([]PushResult, 0, len(tasks))
+	for len(tasks) > 0 {
+		n := BatchSize
+		if n > len(tasks) {
+			n = len(tasks)
+		}
+		items, err := h.pushBatch(tasks[:n])
+		if err != nil {
+			//已成功的批次结果仍返回, 调用方只需重试剩余任务
+			return results, err
+		}
+		results = append(results, items...)
+		tasks = tasks[n:]
+	}
+	return results, nil
+}
+
+// pushBatch 推送一批任务
+func (h *HttpPush) pushBatch(tasks []interface{}) ([]PushResult, error) {
+	uri := h.Url + BatchPath
+	client := httpclient.New()
+	resp, err := client.PostJson(uri, tasks)
+	if err != nil {
+		return nil, err
+	}
+	data := &HttpBatchResp{}
+	if err := resp.Decode(data); err != nil {
+		return nil, err
+	}
+	if data.Code != 0 {
+		return nil, fmt.Errorf("code=%d, message=%s", data.Code, data.Message)
+	}
+	if len(data.Data.Items) != len(tasks) {
+		return nil, fmt.Errorf("batch result size %d, expect %d", len(data.Data.Items), len(tasks))
+	}
+	return data.Data.Items, nil
+}
+
+func (h *HttpPush) Status(taskId string) (*TaskStatus, error) {
+	uri := h.Url + StatusPath + url.PathEscape(taskId)
+	client := httpclient.New()
+	resp, err := client.Get(uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := &HttpStatusResp{}
+	if err := resp.Decode(data); err != nil {
+		return nil, err
+	}
+	if data.Code != 0 {
+		return nil, fmt.Errorf("code=%d, message=%s", data.Code, data.Message)
+	}
+	return &data.Data, nil
+}
+
+func (h *HttpPush) Cancel(taskId string) (bool, error) {
+	uri := h.Url + StatusPath + url.PathEscape(taskId)
+	//httpclient不支持DELETE请求, 使用net/http发送
+	req, err := http.NewRequest(http.MethodDelete, uri, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	data := &HttpCancelResp{}
+	if err := json.NewDecoder(resp.Body).Decode(data); err != nil {
+		return false, err
+	}
+	if data.Code != 0 {
+		return false, fmt.Errorf("code=%d, message=%s", data.Code, data.Message)
+	}
+	return data.Data.Cancelled, nil
+}
+
 func NewHttpCheck(url string) *HttpCheck {
 	url = strings.TrimSuffix(url, "/")
 	return &HttpCheck{Url: url}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/meixiu/utask/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultDeadPageSize 死信任务默认分页大小
+	defaultDeadPageSize = 20
+	// maxDeadPageSize 死信任务最大分页大小
+	maxDeadPageSize = 100
+)
+
+// DeadTask 死信任务信息
+type DeadTask struct {
+	TaskID     string `json:"task_id"`
+	AppID      string `json:"app_id"`
+	Content    string `json:"content"`
+	Result     string `json:"result"`
+	Error      string `json:"error"`
+	Times      int64  `json:"times"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+// TaskAttempt 任务的一次执行记录
+type TaskAttempt struct {
+	Times      int64  `json:"times"`
+	Status     int    `json:"status"`
+	Result     string `json:"result"`
+	Error      string `json:"error"`
+	ExecTime   int64  `json:"exec_time"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// DataDead 死信任务批量操作参数, task_ids为空时需要指定all
+type DataDead struct {
+	TaskIDs []string `json:"task_ids" form:"task_ids"`
+	All     bool     `json:"all" form:"all"`
+}
+
+// DeadList dead letter tasks of app
+func (s *HttpServer) DeadList(ctx *gin.Context) {
+	ds, ok := s.ProcessStore.(store.DeadProcessStorer)
+	if !ok {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: "process store not support dead letter"})
+		return
+	}
+	appId := ctx.Param("app_id")
+	offset, _ := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	size, _ := strconv.Atoi(ctx.DefaultQuery("size", strconv.Itoa(defaultDeadPageSize)))
+	if offset < 0 {
+		offset = 0
+	}
+	if size <= 0 || size > maxDeadPageSize {
+		size = defaultDeadPageSize
+	}
+	items, total, err := ds.Dead(appId, offset, size)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	list := make([]DeadTask, 0, len(items))
+	for _, v := range items {
+		list = append(list, newDeadTask(v))
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"app_id": appId,
+			"total":  total,
+			"list":   list,
+		},
+	})
+	return
+}
+
+// DeadInfo dead letter task with attempt history
+func (s *HttpServer) DeadInfo(ctx *gin.Context) {
+	fs, ok := s.ProcessStore.(store.FindProcessStorer)
+	if !ok {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: "process store not support find"})
+		return
+	}
+	appId, tid := ctx.Param("app_id"), ctx.Param("task_id")
+	item, err := fs.Find(tid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	if item == nil || item.AppID != appId {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: "task not found"})
+		return
+	}
+	history, err := s.history(tid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"task":    newDeadTask(*item),
+			"dead":    isDead(item),
+			"history": history,
+		},
+	})
+	return
+}
+
+// Requeue requeue dead letter tasks
+func (s *HttpServer) Requeue(ctx *gin.Context) {
+	s.deadAction(ctx, "requeued", func(ds store.DeadProcessStorer, appId string, tids []string) (int64, error) {
+		return ds.Revive(appId, tids)
+	})
+}
+
+// Discard discard dead letter tasks
+func (s *HttpServer) Discard(ctx *gin.Context) {
+	s.deadAction(ctx, "discarded", func(ds store.DeadProcessStorer, appId string, tids []string) (int64, error) {
+		return ds.Discard(appId, tids)
+	})
+}
+
+// deadAction 对死信任务执行批量操作
+func (s *HttpServer) deadAction(ctx *gin.Context, name string, action func(store.DeadProcessStorer, string, []string) (int64, error)) {
+	ds, ok := s.ProcessStore.(store.DeadProcessStorer)
+	if !ok {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: "process store not support dead letter"})
+		return
+	}
+	data := &DataDead{}
+	if err := ctx.ShouldBind(data); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeDataBind, Message: "data bind error"})
+		return
+	}
+	//防止误操作全部死信任务
+	if len(data.TaskIDs) == 0 && !data.All {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: "incorrect parameter: task_ids"})
+		return
+	}
+	appId := ctx.Param("app_id")
+	n, err := action(ds, appId, data.TaskIDs)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"app_id": appId,
+			name:     n,
+		},
+	})
+	return
+}
+
+// newDeadTask 转换任务处理区的任务为死信任务信息
+func newDeadTask(v store.TaskItem) DeadTask {
+	return DeadTask{
+		TaskID:     v.TID,
+		AppID:      v.AppID,
+		Content:    store.Plaintext(v.Content),
+		Result:     store.Plaintext(v.Result),
+		Error:      store.Plaintext(v.Error),
+		Times:      v.Times,
+		CreateTime: v.CreateTime,
+		UpdateTime: v.UpdateTime,
+	}
+}
+
+// isDead 判断任务是否为死信
+func isDead(v *store.TaskItem) bool {
+	return v.LockStatus == store.LockStatusDead
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+)
+
+// errIdempotentNotSupport 存储不支持幂等键
+var errIdempotentNotSupport = errors.New("secret store not support idempotency_key")
+
+// idempotencyKey 获取任务的幂等键, 任务类型不支持时为空
+func idempotencyKey(tasker task.Tasker) string {
+	if v, ok := tasker.(task.Idempotent); ok {
+		return v.GetIdempotencyKey()
+	}
+	return ""
+}
+
+// reserve 将任务的幂等键绑定到任务ID, 窗口内重复推送时返回原任务ID, 否则返回空
+func (s *HttpServer) reserve(tasker task.Tasker) (string, error) {
+	key := idempotencyKey(tasker)
+	if key == "" {
+		return "", nil
+	}
+	is, ok := s.SecretStore.(store.IdempotentStorer)
+	if !ok {
+		return "", errIdempotentNotSupport
+	}
+	tid, ok, err := is.Reserve(tasker.GetAppID(), key, tasker.GetID(), s.IdempotencyWindow)
+	if err != nil || ok {
+		return "", err
+	}
+	return tid, nil
+}
+
+// forget 推送失败时解除幂等键绑定, 允许生产者重试
+func (s *HttpServer) forget(tasker task.Tasker) {
+	key := idempotencyKey(tasker)
+	if is, ok := s.SecretStore.(store.IdempotentStorer); ok && key != "" {
+		_ = is.Forget(tasker.GetAppID(), key, tasker.GetID())
+	}
+}
@@ -10,9 +10,13 @@ import (
 
 // Options option info
 type Options struct {
-	TaskStore   store.TaskStorer
-	SecretStore store.SecretStorer
-	Monitor     monitor.ProducerMonitor
+	TaskStore     store.TaskStorer
+	SecretStore   store.SecretStorer
+	ProcessStore  store.ProcessStorer
+	LogStore      store.LogStorer
+	ScheduleStore store.ScheduleStorer
+	WorkflowStore store.WorkflowStorer
+	Monitor       monitor.ProducerMonitor
 }
 
 // Option Option
@@ -21,9 +25,19 @@ type Option func(*Options)
 // NewOptions construct
 func NewOptions(opts ...Option) Options {
 	opt := Options{
-		TaskStore:   store.DefaultRedisStore,
-		SecretStore: store.DefaultRedisStore,
-		Monitor:     monitor.DefaultPromMonitor,
+		TaskStore:    store.DefaultRedisStore,
+		SecretStore:  store.DefaultRedisStore,
+		ProcessStore: store.DefaultDbStore,
+		LogStore:     store.DefaultDbStore,
+		Monitor:      monitor.DefaultPromMonitor,
+	}
+	//计划区使用任务处理区的数据库
+	if s, ok := store.DefaultDbStore.(store.ScheduleStorer); ok {
+		opt.ScheduleStore = s
+	}
+	//工作流区使用任务处理区的数据库
+	if s, ok := store.DefaultDbStore.(store.WorkflowStorer); ok {
+		opt.WorkflowStore = s
 	}
 	for _, o := range opts {
 		o(&opt)
@@ -45,6 +59,34 @@ func SecretStore(s store.SecretStorer) Option {
 	}
 }
 
+// ProcessStore process store
+func ProcessStore(p store.ProcessStorer) Option {
+	return func(o *Options) {
+		o.ProcessStore = p
+	}
+}
+
+// LogStore log store
+func LogStore(l store.LogStorer) Option {
+	return func(o *Options) {
+		o.LogStore = l
+	}
+}
+
+// ScheduleStore schedule store
+func ScheduleStore(s store.ScheduleStorer) Option {
+	return func(o *Options) {
+		o.ScheduleStore = s
+	}
+}
+
+// WorkflowStore workflow store
+func WorkflowStore(w store.WorkflowStorer) Option {
+	return func(o *Options) {
+		o.WorkflowStore = w
+	}
+}
+
 // Monitor monitor
 func Monitor(m monitor.ProducerMonitor) Option {
 	return func(o *Options) {
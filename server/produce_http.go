@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -20,17 +22,48 @@ const (
 	errCodeDataBind   = 1002 // 参数绑定错误
 	errCodeParams     = 1003 // 参数错误
 	errCodePushQueue  = 1004 // 入队列错误
+	errCodeNotSupport = 1005 // 数据源不支持该操作
+	errCodeStore      = 1006 // 数据源操作错误
+	errCodeBatchSize  = 1007 // 批量任务数超过限制
 	errCodeCheckToken = 2001 // token校验错误
 )
 
+var (
+	// DefaultMaxBatch 未配置server.max_batch时批量推送单次最大任务数
+	DefaultMaxBatch = 1000
+	// DefaultIdempotencyWindow 未配置server.idempotency_window时幂等键去重窗口
+	DefaultIdempotencyWindow = 24 * time.Hour
+	// DefaultMaxTimeout 未配置server.max_timeout时任务执行超时时间的最大值(秒)
+	DefaultMaxTimeout = int64(3600)
+)
+
 // NewHttpServer http server cli
 func NewHttpServer(id string, opts Options) Producer {
+	maxBatch := app.Config.Server.MaxBatch
+	if maxBatch <= 0 {
+		maxBatch = DefaultMaxBatch
+	}
+	window := time.Duration(app.Config.Server.IdempotencyWindow) * time.Second
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	maxTimeout := app.Config.Server.MaxTimeout
+	if maxTimeout <= 0 {
+		maxTimeout = DefaultMaxTimeout
+	}
 	return &HttpServer{
-		ID:          id,
-		Addr:        app.Config.Server.Addr,
-		TaskStore:   opts.TaskStore,
-		SecretStore: opts.SecretStore,
-		Monitor:     opts.Monitor,
+		ID:                id,
+		Addr:              app.Config.Server.Addr,
+		MaxBatch:          maxBatch,
+		IdempotencyWindow: window,
+		MaxTimeout:        maxTimeout,
+		TaskStore:         opts.TaskStore,
+		SecretStore:       opts.SecretStore,
+		ProcessStore:      opts.ProcessStore,
+		LogStore:          opts.LogStore,
+		ScheduleStore:     opts.ScheduleStore,
+		WorkflowStore:     opts.WorkflowStore,
+		Monitor:           opts.Monitor,
 	}
 }
 
@@ -43,13 +76,28 @@ type HttpResp struct {
 
 // HttpServer server
 type HttpServer struct {
-	ID          string
-	TaskStore   store.TaskStorer
-	SecretStore store.SecretStorer
-	Monitor     monitor.ProducerMonitor
+	ID            string
+	TaskStore     store.TaskStorer
+	SecretStore   store.SecretStorer
+	ProcessStore  store.ProcessStorer
+	LogStore      store.LogStorer
+	ScheduleStore store.ScheduleStorer
+	WorkflowStore store.WorkflowStorer
+	Monitor       monitor.ProducerMonitor
 
-	Server *http.Server
-	Addr   string
+	Server            *http.Server
+	Addr              string
+	MaxBatch          int
+	IdempotencyWindow time.Duration
+	MaxTimeout        int64
+}
+
+// BatchItem 批量推送中单个任务的结果
+type BatchItem struct {
+	TaskID     string `json:"task_id,omitempty"`
+	Duplicated bool   `json:"duplicated,omitempty"` // 幂等键重复, TaskID为原任务ID
+	Unique     string `json:"unique,omitempty"`     // 已有同唯一键的待执行任务时执行的策略, TaskID为已有任务ID
+	Error      string `json:"error,omitempty"`
 }
 
 // MwPrometheusHttp middleware
@@ -65,17 +113,9 @@ func (s *HttpServer) MwPrometheusHttp(c *gin.Context) {
 
 // ListenAndServe listens
 func (s *HttpServer) ListenAndServe() error {
-	router := gin.Default()
-
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
-	api := router.Group("api").Use(s.MwPrometheusHttp)
-
-	api.POST("/task/:type", s.Handle)
-	api.POST("/check", s.Check)
-
 	s.Server = &http.Server{
 		Addr:           s.Addr,
-		Handler:        router,
+		Handler:        s.Router(),
 		ReadTimeout:    30 * time.Second,
 		WriteTimeout:   30 * time.Second,
 		MaxHeaderBytes: 1 << 20,
@@ -83,6 +123,36 @@ func (s *HttpServer) ListenAndServe() error {
 	return s.Server.ListenAndServe()
 }
 
+// Router 返回注册了全部接口的路由
+func (s *HttpServer) Router() *gin.Engine {
+	router := gin.Default()
+
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	api := router.Group("api").Use(s.MwPrometheusHttp)
+
+	api.POST("/task/:type", s.Handle)
+	api.POST("/tasks/:type", s.HandleBatch)
+	api.GET("/task/:id", s.Status)
+	api.DELETE("/task/:id", s.Cancel)
+	api.PATCH("/task/:id", s.Patch)
+	api.POST("/check", s.Check)
+	api.GET("/queue/:app_id", s.QueueLen)
+	api.DELETE("/queue/:app_id", s.Purge)
+	api.GET("/dead/:app_id", s.DeadList)
+	api.GET("/dead/:app_id/:task_id", s.DeadInfo)
+	api.POST("/dead/:app_id/requeue", s.Requeue)
+	api.POST("/dead/:app_id/discard", s.Discard)
+	api.POST("/schedule", s.AddSchedule)
+	api.GET("/schedules/:app_id", s.ScheduleList)
+	api.GET("/schedule/:id", s.ScheduleInfo)
+	api.DELETE("/schedule/:id", s.RemoveSchedule)
+	api.POST("/schedule/:id/pause", s.PauseSchedule)
+	api.POST("/schedule/:id/resume", s.ResumeSchedule)
+	api.POST("/workflow", s.AddWorkflow)
+	api.GET("/workflow/:id", s.WorkflowInfo)
+	return router
+}
+
 // Shutdown Shutdown
 func (s *HttpServer) Shutdown(ctx context.Context) error {
 	return s.Server.Shutdown(ctx)
@@ -101,20 +171,122 @@ func (s *HttpServer) Handle(ctx *gin.Context) {
 		return
 	}
 	// 校验参数
-	if err := tasker.Validate(); err != nil {
+	if err := s.validate(tasker); err != nil {
 		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: err.Error()})
 		return
 	}
-	ok, err := Push(s.ID, s.TaskStore, tasker)
-	if err != nil || !ok {
-		ctx.JSON(http.StatusOK, HttpResp{Code: errCodePushQueue, Message: "add queue error"})
+	tasker.Init(s.ID)
+	//幂等键重复或已有同唯一键的待执行任务时返回已有任务ID, 不再入队
+	item, push, err := s.dedupe(tasker)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: dedupeCode(err), Message: err.Error()})
+		return
+	}
+	if push {
+		ok, err := s.TaskStore.RPush(tasker)
+		if err != nil || !ok {
+			s.release(tasker)
+			ctx.JSON(http.StatusOK, HttpResp{Code: errCodePushQueue, Message: "add queue error"})
+			return
+		}
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"task_id":    item.TaskID,
+			"duplicated": item.Duplicated,
+			"unique":     item.Unique,
+		},
+	})
+	return
+}
+
+// validate 校验任务参数, 执行超时时间不能超过server.max_timeout
+func (s *HttpServer) validate(tasker task.Tasker) error {
+	if err := tasker.Validate(); err != nil {
+		return err
+	}
+	if tasker.Timeout() > s.MaxTimeout {
+		return fmt.Errorf("incorrect parameter: timeout, max %d", s.MaxTimeout)
+	}
+	return nil
+}
+
+// HandleBatch handle a json array of tasks, pushed in one store call
+func (s *HttpServer) HandleBatch(ctx *gin.Context) {
+	t := ctx.Param("type")
+	if task.Lookup(t) == nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeDataType, Message: "data type error"})
 		return
 	}
+	var raws []json.RawMessage
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&raws); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeDataBind, Message: "data bind error"})
+		return
+	}
+	if len(raws) == 0 || len(raws) > s.MaxBatch {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeBatchSize, Message: fmt.Sprintf("batch size must be 1-%d", s.MaxBatch)})
+		return
+	}
+	// 逐个绑定校验参数, 只推送校验通过的任务
+	items := make([]BatchItem, len(raws))
+	index := make([]int, 0, len(raws))
+	tasks := make([]task.Tasker, 0, len(raws))
+	for i, raw := range raws {
+		tasker := task.Lookup(t)
+		if err := json.Unmarshal(raw, tasker); err != nil {
+			items[i].Error = "data bind error"
+			continue
+		}
+		if err := s.validate(tasker); err != nil {
+			items[i].Error = err.Error()
+			continue
+		}
+		tasker.Init(s.ID)
+		item, push, err := s.dedupe(tasker)
+		if err != nil {
+			items[i].Error = err.Error()
+			continue
+		}
+		if !push {
+			items[i] = item
+			continue
+		}
+		index = append(index, i)
+		tasks = append(tasks, tasker)
+	}
+	if len(tasks) > 0 {
+		errs, err := RPushBatch(s.TaskStore, tasks)
+		if err != nil {
+			for _, tasker := range tasks {
+				s.release(tasker)
+			}
+			ctx.JSON(http.StatusOK, HttpResp{Code: errCodePushQueue, Message: "add queue error"})
+			return
+		}
+		for j, i := range index {
+			if errs[j] != nil {
+				s.release(tasks[j])
+				items[i].Error = "add queue error"
+				continue
+			}
+			items[i].TaskID = tasks[j].GetID()
+		}
+	}
+	succeeded := 0
+	for _, v := range items {
+		if v.Error == "" {
+			succeeded++
+		}
+	}
 	ctx.JSON(http.StatusOK, HttpResp{
 		Code:    0,
 		Message: "success",
 		Data: gin.H{
-			"task_id": tasker.GetID(),
+			"items":     items,
+			"succeeded": succeeded,
+			"failed":    len(items) - succeeded,
 		},
 	})
 	return
@@ -137,6 +309,54 @@ func (s *HttpServer) Check(ctx *gin.Context) {
 	return
 }
 
+// QueueLen queue length of app
+func (s *HttpServer) QueueLen(ctx *gin.Context) {
+	qs, ok := s.TaskStore.(store.QueueTaskStorer)
+	if !ok {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: "task store not support queue"})
+		return
+	}
+	appId := ctx.Param("app_id")
+	n, err := qs.QueueLen(appId)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"app_id": appId,
+			"length": n,
+		},
+	})
+	return
+}
+
+// Purge purge queue of app
+func (s *HttpServer) Purge(ctx *gin.Context) {
+	qs, ok := s.TaskStore.(store.QueueTaskStorer)
+	if !ok {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: "task store not support queue"})
+		return
+	}
+	appId := ctx.Param("app_id")
+	n, err := qs.Purge(appId)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"app_id": appId,
+			"purged": n,
+		},
+	})
+	return
+}
+
 // DataCheck token check struct
 type DataCheck struct {
 	TaskID string `json:"task_id" form:"task_id"`
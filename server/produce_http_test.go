@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meixiu/utask/store/memory"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nopMonitor 不做统计的ProducerMonitor
+type nopMonitor struct{}
+
+func (nopMonitor) Request(string)                        {}
+func (nopMonitor) Latency(string, string, time.Duration) {}
+
+// testResp 解析后的接口返回包
+type testResp struct {
+	Code    int                    `json:"code"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// newTestServer 返回使用内存Store的HttpServer及其路由
+func newTestServer() (*HttpServer, http.Handler) {
+	gin.SetMode(gin.TestMode)
+	m := memory.NewStore()
+	s := NewHttpServer("test", NewOptions(
+		TaskStore(m), SecretStore(m), ProcessStore(m), LogStore(m),
+		ScheduleStore(m), WorkflowStore(m), Monitor(nopMonitor{}))).(*HttpServer)
+	return s, s.Router()
+}
+
+// call 发送请求并解析返回包
+func call(t *testing.T, h http.Handler, method, path, body string) testResp {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	resp := testResp{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: %v, body %s", method, path, err, w.Body.String())
+	}
+	return resp
+}
+
+func TestHandle(t *testing.T) {
+	_, h := newTestServer()
+	cases := []struct {
+		name string
+		path string
+		body string
+		code int
+	}{
+		{"push", "/api/task/http", `{"app_id": "100", "url": "http://example.com"}`, 0},
+		{"post form", "/api/task/http", `{"app_id": "100", "url": "http://example.com", "method": "POST", "content_type": "form", "body": "{\"a\": 1}"}`, 0},
+		{"unknown type", "/api/task/rpc", `{"app_id": "100", "url": "http://example.com"}`, errCodeDataType},
+		{"bad json", "/api/task/http", `{"app_id": `, errCodeDataBind},
+		{"relative url", "/api/task/http", `{"app_id": "100", "url": "example.com"}`, errCodeParams},
+		{"bad method", "/api/task/http", `{"app_id": "100", "url": "http://example.com", "method": "TRACE"}`, errCodeParams},
+		{"reserved header", "/api/task/http", `{"app_id": "100", "url": "http://example.com", "headers": {"u-task-token": "x"}}`, errCodeParams},
+		{"timeout too large", "/api/task/http", `{"app_id": "100", "url": "http://example.com", "timeout": 7200}`, errCodeParams},
+		{"bad retry", "/api/task/http", `{"app_id": "100", "url": "http://example.com", "retry": {"strategy": "fixed"}}`, errCodeParams},
+		{"bad success", "/api/task/http", `{"app_id": "100", "url": "http://example.com", "success": {"mode": "status"}}`, errCodeParams},
+	}
+	for _, c := range cases {
+		resp := call(t, h, http.MethodPost, c.path, c.body)
+		if resp.Code != c.code {
+			t.Errorf("%s: code = %d %s, want %d", c.name, resp.Code, resp.Message, c.code)
+		}
+		if c.code == 0 && resp.Data["task_id"] == "" {
+			t.Errorf("%s: empty task_id", c.name)
+		}
+	}
+}
+
+func TestHandleIdempotency(t *testing.T) {
+	_, h := newTestServer()
+	body := `{"app_id": "100", "url": "http://example.com", "idempotency_key": "order-1"}`
+	first := call(t, h, http.MethodPost, "/api/task/http", body)
+	second := call(t, h, http.MethodPost, "/api/task/http", body)
+	if first.Code != 0 || second.Code != 0 {
+		t.Fatalf("code = %d, %d", first.Code, second.Code)
+	}
+	if second.Data["task_id"] != first.Data["task_id"] || second.Data["duplicated"] != true {
+		t.Errorf("second push = %v, want duplicated of %v", second.Data, first.Data["task_id"])
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	_, h := newTestServer()
+	resp := call(t, h, http.MethodPost, "/api/tasks/http", `[
+		{"app_id": "100", "url": "http://example.com"},
+		{"app_id": "100", "url": "example.com"},
+		{"app_id": "100", "url": "http://example.com", "priority": 5}
+	]`)
+	if resp.Code != 0 {
+		t.Fatalf("code = %d %s", resp.Code, resp.Message)
+	}
+	if resp.Data["succeeded"] != float64(2) || resp.Data["failed"] != float64(1) {
+		t.Errorf("data = %v, want 2 succeeded 1 failed", resp.Data)
+	}
+	items := resp.Data["items"].([]interface{})
+	if items[1].(map[string]interface{})["error"] == nil {
+		t.Errorf("items[1] = %v, want error", items[1])
+	}
+	if resp := call(t, h, http.MethodPost, "/api/tasks/http", `[]`); resp.Code != errCodeBatchSize {
+		t.Errorf("empty batch code = %d, want %d", resp.Code, errCodeBatchSize)
+	}
+}
+
+func TestTaskLifecycle(t *testing.T) {
+	_, h := newTestServer()
+	resp := call(t, h, http.MethodPost, "/api/task/http", `{"app_id": "100", "url": "http://example.com", "expect_time": 600}`)
+	tid, _ := resp.Data["task_id"].(string)
+	if resp.Code != 0 || tid == "" {
+		t.Fatalf("push = %d %s", resp.Code, resp.Message)
+	}
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+		key    string
+		want   interface{}
+	}{
+		{"status", http.MethodGet, "/api/task/" + tid, "", 0, "state", TaskStateScheduled},
+		{"patch", http.MethodPatch, "/api/task/" + tid, `{"url": "http://example.com/v2"}`, 0, "patched", true},
+		{"patch state", http.MethodPatch, "/api/task/" + tid, `{"expect_time": 1200}`, 0, "state", TaskStateScheduled},
+		{"patch to now", http.MethodPatch, "/api/task/" + tid, `{"expect_time": 0}`, 0, "state", TaskStateQueued},
+		{"bad patch", http.MethodPatch, "/api/task/" + tid, `{"url": "v2"}`, errCodeParams, "", nil},
+		{"cancel", http.MethodDelete, "/api/task/" + tid, "", 0, "cancelled", true},
+		{"cancel again", http.MethodDelete, "/api/task/" + tid, "", 0, "state", TaskStateNotFound},
+		{"status after cancel", http.MethodGet, "/api/task/" + tid, "", errCodeParams, "", nil},
+	}
+	for _, s := range steps {
+		resp := call(t, h, s.method, s.path, s.body)
+		if resp.Code != s.code {
+			t.Fatalf("%s: code = %d %s, want %d", s.name, resp.Code, resp.Message, s.code)
+		}
+		if s.key != "" && resp.Data[s.key] != s.want {
+			t.Errorf("%s: %s = %v, want %v", s.name, s.key, resp.Data[s.key], s.want)
+		}
+	}
+}
+
+func TestWorkflow(t *testing.T) {
+	_, h := newTestServer()
+	cases := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"cycle", `{"app_id": "100", "type": "http", "nodes": [
+			{"name": "a", "depends": ["b"], "task": {"app_id": "100", "url": "http://example.com"}},
+			{"name": "b", "depends": ["a"], "task": {"app_id": "100", "url": "http://example.com"}}]}`, errCodeParams},
+		{"unknown type", `{"app_id": "100", "type": "rpc", "nodes": [
+			{"name": "a", "task": {"app_id": "100", "url": "http://example.com"}}]}`, errCodeDataType},
+		{"empty", `{"app_id": "100", "type": "http", "nodes": []}`, errCodeParams},
+	}
+	for _, c := range cases {
+		if resp := call(t, h, http.MethodPost, "/api/workflow", c.body); resp.Code != c.code {
+			t.Errorf("%s: code = %d %s, want %d", c.name, resp.Code, resp.Message, c.code)
+		}
+	}
+
+	resp := call(t, h, http.MethodPost, "/api/workflow", `{"app_id": "100", "name": "w", "type": "http", "nodes": [
+		{"name": "a", "task": {"app_id": "100", "url": "http://example.com"}},
+		{"name": "b", "depends": ["a"], "task": {"app_id": "100", "url": "http://example.com"}}]}`)
+	id, _ := resp.Data["workflow_id"].(string)
+	if resp.Code != 0 || id == "" {
+		t.Fatalf("add workflow = %d %s", resp.Code, resp.Message)
+	}
+	resp = call(t, h, http.MethodGet, "/api/workflow/"+id, "")
+	if resp.Code != 0 || resp.Data["status"] != "running" {
+		t.Fatalf("workflow info = %d %v", resp.Code, resp.Data)
+	}
+	want := map[string]string{"a": "pushed", "b": "waiting"}
+	tid := ""
+	for _, n := range resp.Data["nodes"].([]interface{}) {
+		node := n.(map[string]interface{})
+		if node["status"] != want[node["name"].(string)] {
+			t.Errorf("node %v status = %v, want %s", node["name"], node["status"], want[node["name"].(string)])
+		}
+		if node["name"] == "a" {
+			tid, _ = node["task_id"].(string)
+		}
+	}
+
+	//取消队列中的节点任务, 工作流失败
+	if resp := call(t, h, http.MethodDelete, "/api/task/"+tid, ""); resp.Data["cancelled"] != true {
+		t.Fatalf("cancel node = %d %v", resp.Code, resp.Data)
+	}
+	resp = call(t, h, http.MethodGet, "/api/workflow/"+id, "")
+	if resp.Data["status"] != "failed" {
+		t.Errorf("workflow status after cancel = %v, want failed", resp.Data["status"])
+	}
+}
+
+func TestDeadList(t *testing.T) {
+	_, h := newTestServer()
+	resp := call(t, h, http.MethodGet, "/api/dead/100?offset=0&size=20", "")
+	if resp.Code != 0 {
+		t.Fatalf("code = %d %s", resp.Code, resp.Message)
+	}
+}
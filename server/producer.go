@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 
 	"github.com/meixiu/utask/store"
 	"github.com/meixiu/utask/task"
@@ -18,3 +19,27 @@ func Push(sid string, store store.TaskStorer, task task.Tasker) (bool, error) {
 	task.Init(sid)
 	return store.RPush(task)
 }
+
+// PushBatch push tasks in one call when store supports batch
+func PushBatch(sid string, s store.TaskStorer, tasks []task.Tasker) ([]error, error) {
+	for _, task := range tasks {
+		task.Init(sid)
+	}
+	return RPushBatch(s, tasks)
+}
+
+// RPushBatch push tasks which have been initialized
+func RPushBatch(s store.TaskStorer, tasks []task.Tasker) ([]error, error) {
+	if bs, ok := s.(store.BatchTaskStorer); ok {
+		return bs.RPushBatch(tasks)
+	}
+	errs := make([]error, len(tasks))
+	for i, task := range tasks {
+		ok, err := s.RPush(task)
+		if err == nil && !ok {
+			err = errors.New("add queue error")
+		}
+		errs[i] = err
+	}
+	return errs, nil
+}
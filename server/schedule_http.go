@@ -0,0 +1,273 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/meixiu/utask/schedule"
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errNoNextTime cron表达式没有下次执行时间
+var errNoNextTime = errors.New("incorrect parameter: cron, no next time")
+
+// Schedule 周期任务计划信息
+type Schedule struct {
+	ScheduleID string `json:"schedule_id"`
+	AppID      string `json:"app_id"`
+	Name       string `json:"name"`
+	Cron       string `json:"cron"`
+	Timezone   string `json:"timezone"`
+	Type       string `json:"type"`
+	Content    string `json:"content"`
+	Missed     string `json:"missed"`
+	Paused     bool   `json:"paused"`
+	NextTime   int64  `json:"next_time"`
+	LastTime   int64  `json:"last_time"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+// DataSchedule 周期任务计划参数
+type DataSchedule struct {
+	Name     string          `json:"name"`
+	Cron     string          `json:"cron" binding:"required"`
+	Timezone string          `json:"timezone"` // IANA时区名, 为空时使用服务所在时区
+	Type     string          `json:"type"`     // 任务类型, 默认为http
+	Missed   string          `json:"missed"`   // 错过执行的处理: skip(默认)|once|catchup
+	Task     json.RawMessage `json:"task" binding:"required"`
+}
+
+// AddSchedule register a recurring schedule
+func (s *HttpServer) AddSchedule(ctx *gin.Context) {
+	if s.ScheduleStore == nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: "schedule store not configured"})
+		return
+	}
+	data := &DataSchedule{}
+	if err := ctx.ShouldBindJSON(data); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeDataBind, Message: "data bind error"})
+		return
+	}
+	if data.Type == "" {
+		data.Type = "http"
+	}
+	if data.Missed == "" {
+		data.Missed = schedule.MissedSkip
+	}
+	if !schedule.IsMissed(data.Missed) {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: "incorrect parameter: missed"})
+		return
+	}
+	now := time.Now()
+	next, err := schedule.Next(data.Cron, data.Timezone, now)
+	if err == nil && next == 0 {
+		err = errNoNextTime
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: err.Error()})
+		return
+	}
+	// 任务模板与推送任务的参数相同, 执行时间由计划决定
+	tasker := task.Lookup(data.Type)
+	if tasker == nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeDataType, Message: "data type error"})
+		return
+	}
+	if err := json.Unmarshal(data.Task, tasker); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeDataBind, Message: "data bind error"})
+		return
+	}
+	if err := s.validate(tasker); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: err.Error()})
+		return
+	}
+	template, err := store.Encode(tasker)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	sc := &store.TaskSchedule{
+		ScheduleID: uuid.New().String(),
+		AppID:      tasker.GetAppID(),
+		Name:       data.Name,
+		Cron:       data.Cron,
+		Timezone:   data.Timezone,
+		Type:       data.Type,
+		Template:   template,
+		Content:    store.Readable(tasker.GetContent()),
+		Missed:     data.Missed,
+		NextTime:   next,
+		CreateTime: now.Unix(),
+		UpdateTime: now.Unix(),
+	}
+	if err := s.ScheduleStore.AddSchedule(sc); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data:    newSchedule(*sc),
+	})
+	return
+}
+
+// ScheduleList schedules of app
+func (s *HttpServer) ScheduleList(ctx *gin.Context) {
+	if s.ScheduleStore == nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: "schedule store not configured"})
+		return
+	}
+	appId := ctx.Param("app_id")
+	offset, _ := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	size, _ := strconv.Atoi(ctx.DefaultQuery("size", strconv.Itoa(defaultDeadPageSize)))
+	if offset < 0 {
+		offset = 0
+	}
+	if size <= 0 || size > maxDeadPageSize {
+		size = defaultDeadPageSize
+	}
+	m, total, err := s.ScheduleStore.ListSchedules(appId, offset, size)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	list := make([]Schedule, 0, len(m))
+	for _, v := range m {
+		list = append(list, newSchedule(v))
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"app_id": appId,
+			"total":  total,
+			"list":   list,
+		},
+	})
+	return
+}
+
+// ScheduleInfo schedule info
+func (s *HttpServer) ScheduleInfo(ctx *gin.Context) {
+	sc, ok := s.schedule(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data:    newSchedule(*sc),
+	})
+	return
+}
+
+// RemoveSchedule remove schedule, tasks already pushed are not affected
+func (s *HttpServer) RemoveSchedule(ctx *gin.Context) {
+	sc, ok := s.schedule(ctx)
+	if !ok {
+		return
+	}
+	removed, err := s.ScheduleStore.RemoveSchedule(sc.ScheduleID)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"schedule_id": sc.ScheduleID,
+			"removed":     removed,
+		},
+	})
+	return
+}
+
+// PauseSchedule pause schedule
+func (s *HttpServer) PauseSchedule(ctx *gin.Context) {
+	s.pauseSchedule(ctx, true)
+}
+
+// ResumeSchedule resume schedule, runs missed while paused are skipped
+func (s *HttpServer) ResumeSchedule(ctx *gin.Context) {
+	s.pauseSchedule(ctx, false)
+}
+
+// pauseSchedule 暂停或恢复计划
+func (s *HttpServer) pauseSchedule(ctx *gin.Context, paused bool) {
+	sc, ok := s.schedule(ctx)
+	if !ok {
+		return
+	}
+	next := sc.NextTime
+	if !paused {
+		//暂停期间错过的执行不再补上
+		n, err := schedule.Next(sc.Cron, sc.Timezone, time.Now())
+		if err != nil {
+			ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: err.Error()})
+			return
+		}
+		next = n
+	}
+	if _, err := s.ScheduleStore.PauseSchedule(sc.ScheduleID, paused, next); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	sc.Paused = 0
+	if paused {
+		sc.Paused = 1
+	}
+	sc.NextTime = next
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data:    newSchedule(*sc),
+	})
+	return
+}
+
+// schedule 根据路径参数查询计划, 不存在时返回错误响应
+func (s *HttpServer) schedule(ctx *gin.Context) (*store.TaskSchedule, bool) {
+	if s.ScheduleStore == nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: "schedule store not configured"})
+		return nil, false
+	}
+	sc, err := s.ScheduleStore.GetSchedule(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return nil, false
+	}
+	if sc == nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: "schedule not found"})
+		return nil, false
+	}
+	return sc, true
+}
+
+// newSchedule 转换计划区的计划为计划信息
+func newSchedule(v store.TaskSchedule) Schedule {
+	return Schedule{
+		ScheduleID: v.ScheduleID,
+		AppID:      v.AppID,
+		Name:       v.Name,
+		Cron:       v.Cron,
+		Timezone:   v.Timezone,
+		Type:       v.Type,
+		Content:    store.Plaintext(v.Content),
+		Missed:     v.Missed,
+		Paused:     v.Paused == 1,
+		NextTime:   v.NextTime,
+		LastTime:   v.LastTime,
+		CreateTime: v.CreateTime,
+		UpdateTime: v.UpdateTime,
+	}
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/meixiu/utask/log"
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TaskStateQueued    = "queued"    // 在任务数据源中等待拉取
+	TaskStateScheduled = "scheduled" // 未到期的延时、定时任务
+	TaskStateRunning   = "running"   // 已被消费者锁定, 等待执行或执行中
+	TaskStateRetrying  = "retrying"  // 执行失败, 等待下次重试
+	TaskStateSucceeded = "succeeded" // 执行成功
+	TaskStateDead      = "dead"      // 死信任务
+	TaskStateUnknown   = "unknown"   // 只有执行日志, 任务已被删除
+	TaskStateCancelled = "cancelled" // 已取消
+	TaskStateNotFound  = "not_found" // 任务不存在或已执行完成
+)
+
+// TaskStatus 任务状态
+type TaskStatus struct {
+	TaskID     string        `json:"task_id"`
+	AppID      string        `json:"app_id"`
+	State      string        `json:"state"`
+	Times      int64         `json:"times"`
+	MaxTimes   int64         `json:"max_times"`
+	NextTime   int64         `json:"next_time"`
+	LastResult string        `json:"last_result"`
+	LastError  string        `json:"last_error"`
+	History    []TaskAttempt `json:"history"`
+}
+
+// Status task status
+func (s *HttpServer) Status(ctx *gin.Context) {
+	tid := ctx.Param("id")
+	history, err := s.history(tid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	status := &TaskStatus{TaskID: tid, History: history}
+	if n := len(history); n > 0 {
+		last := history[n-1]
+		status.Times = last.Times
+		status.LastResult = last.Result
+		status.LastError = last.Error
+	}
+
+	found, err := s.statusFromProcess(status)
+	if err == nil && !found {
+		found, err = s.statusFromQueue(status)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	if !found {
+		if len(history) == 0 {
+			ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: "task not found"})
+			return
+		}
+		//已离开任务处理区, 最后一次执行成功即为成功
+		status.State = TaskStateUnknown
+		if history[len(history)-1].Status == 1 {
+			status.State = TaskStateSucceeded
+		}
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data:    status,
+	})
+	return
+}
+
+// Cancel cancel task which is not running
+func (s *HttpServer) Cancel(ctx *gin.Context) {
+	cs, ok := s.TaskStore.(store.CancelTaskStorer)
+	if !ok {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: "task store not support cancel"})
+		return
+	}
+	tid := ctx.Param("id")
+	n, err := cs.Cancel(tid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	state := TaskStateCancelled
+	if n == store.CancelRunning {
+		//任务已开始执行, 取消失败
+		state = TaskStateRunning
+	} else {
+		//已取消标记阻止后续执行, 任务处理区中的任务直接删除
+		removed := n == store.CancelRemoved
+		if ps, ok := s.ProcessStore.(store.CancelProcessStorer); ok {
+			ok, err := ps.Remove(tid)
+			if err != nil {
+				ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+				return
+			}
+			removed = removed || ok
+		}
+		if !removed {
+			state = TaskStateNotFound
+		} else if err := s.workflow().Cancel(tid); err != nil {
+			//已移出队列的节点任务不会再被消费者处理, 在此使工作流失败
+			log.Error("task cancel workflow err, task: ", tid, " err: ", err)
+		}
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"task_id":   tid,
+			"cancelled": state == TaskStateCancelled,
+			"state":     state,
+		},
+	})
+	return
+}
+
+// Patch 修改未被消费者取出或锁定的任务的到期时间、请求地址和请求内容
+func (s *HttpServer) Patch(ctx *gin.Context) {
+	p := task.Patch{}
+	if err := ctx.ShouldBindJSON(&p); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: err.Error()})
+		return
+	}
+	tid := ctx.Param("id")
+	n, err := s.patch(tid, p)
+	if errors.Is(err, store.ErrPatchInvalid) || errors.Is(err, store.ErrPatchNotSupport) {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	state := TaskStateNotFound
+	switch n {
+	case store.PatchApplied:
+		//修改后的到期时间在未来时为scheduled
+		state = TaskStateQueued
+		if status, err := s.pending(tid); err == nil && status != nil {
+			state = status.State
+		}
+	case store.PatchLeased:
+		state = TaskStateRunning
+	case store.PatchDead:
+		state = TaskStateDead
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"task_id": tid,
+			"patched": n == store.PatchApplied,
+			"state":   state,
+		},
+	})
+	return
+}
+
+// patch 依次在数据源、任务处理区中修改任务
+func (s *HttpServer) patch(tid string, p task.Patch) (int, error) {
+	n := store.PatchNotFound
+	var err error
+	if ts, ok := s.TaskStore.(store.PatchTaskStorer); ok {
+		n, err = ts.Patch(tid, p)
+	}
+	if err == nil && n == store.PatchNotFound {
+		if ps, ok := s.ProcessStore.(store.PatchProcessStorer); ok {
+			n, err = ps.Patch(tid, p)
+		}
+	}
+	return n, err
+}
+
+// statusFromProcess 从任务处理区获取任务状态
+func (s *HttpServer) statusFromProcess(status *TaskStatus) (bool, error) {
+	fs, ok := s.ProcessStore.(store.FindProcessStorer)
+	if !ok {
+		return false, nil
+	}
+	v, err := fs.Find(status.TaskID)
+	if err != nil || v == nil {
+		return false, err
+	}
+	item, err := store.Decode(v.Task)
+	if err != nil {
+		return false, err
+	}
+	status.AppID = v.AppID
+	status.Times = item.GetTimes()
+	status.MaxTimes = store.MaxTimesOf(v)
+	status.LastResult = store.Plaintext(v.Result)
+	status.LastError = store.Plaintext(v.Error)
+	status.NextTime = nextTime(item)
+	now := time.Now().Unix()
+	switch {
+	case isDead(v):
+		status.State = TaskStateDead
+		status.NextTime = 0
+	case item.GetTimes() > 0 && !(v.LockStatus == 1 && item.GetNextTime() <= now):
+		status.State = TaskStateRetrying
+	case item.GetTimes() == 0 && item.GetExpectTime() > now:
+		status.State = TaskStateScheduled
+	case item.GetTimes() == 0 && v.LockStatus != 1:
+		//未锁定或在消费者中等待执行
+		status.State = TaskStateQueued
+	default:
+		status.State = TaskStateRunning
+	}
+	return true, nil
+}
+
+// statusFromQueue 从任务数据源获取任务状态
+func (s *HttpServer) statusFromQueue(status *TaskStatus) (bool, error) {
+	ls, ok := s.TaskStore.(store.LookupTaskStorer)
+	if !ok {
+		return false, nil
+	}
+	item, at, err := ls.Lookup(status.TaskID)
+	if err != nil || item == nil {
+		return false, err
+	}
+	status.AppID = item.GetAppID()
+	status.Times = item.GetTimes()
+	status.MaxTimes = int64(store.RetryPolicyOf(item).MaxTimes)
+	status.NextTime = nextTime(item)
+	switch {
+	case at > 0 && item.GetTimes() > 0:
+		status.State = TaskStateRetrying
+		status.NextTime = at
+	case at > 0 || item.GetExpectTime() > time.Now().Unix():
+		status.State = TaskStateScheduled
+	default:
+		status.State = TaskStateQueued
+	}
+	return true, nil
+}
+
+// history 获取任务的执行记录
+func (s *HttpServer) history(tid string) ([]TaskAttempt, error) {
+	history := make([]TaskAttempt, 0)
+	hs, ok := s.LogStore.(store.HistoryLogStorer)
+	if !ok {
+		return history, nil
+	}
+	logs, err := hs.History(tid)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range logs {
+		history = append(history, TaskAttempt{
+			Times:      v.Times,
+			Status:     v.Status,
+			Result:     store.Plaintext(v.Result),
+			Error:      store.Plaintext(v.Error),
+			ExecTime:   v.ExecTime,
+			CreateTime: v.CreateTime,
+		})
+	}
+	return history, nil
+}
+
+// nextTime 任务的下次执行时间
+func nextTime(item task.Tasker) int64 {
+	if item.GetNextTime() > item.GetExpectTime() {
+		return item.GetNextTime()
+	}
+	return item.GetExpectTime()
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+)
+
+var (
+	// UniqueLockTime 唯一键锁在任务到期后的保留时间, 过期后从任务处理区按唯一键查找等待重试的任务
+	UniqueLockTime = 24 * time.Hour
+	// uniqueRetryTimes 唯一键锁并发冲突的重试次数
+	uniqueRetryTimes = 3
+
+	// errUniqueNotSupport 数据源不支持唯一键
+	errUniqueNotSupport = errors.New("task store not support unique_key")
+	// errUniqueConflict 唯一键锁并发冲突
+	errUniqueConflict = errors.New("unique_key conflict, retry later")
+)
+
+// dedupe 推送前按幂等键、唯一键去重; 返回false时任务不需要入队, item为已有任务的处理结果
+func (s *HttpServer) dedupe(tasker task.Tasker) (BatchItem, bool, error) {
+	tid, err := s.reserve(tasker)
+	if err != nil {
+		return BatchItem{}, false, err
+	}
+	if tid != "" {
+		return BatchItem{TaskID: tid, Duplicated: true}, false, nil
+	}
+	tid, action, err := s.unique(tasker)
+	if err != nil || tid != "" {
+		//新任务不入队, 重试时按唯一键策略重新处理
+		s.forget(tasker)
+	}
+	if err != nil {
+		return BatchItem{}, false, err
+	}
+	if tid != "" {
+		return BatchItem{TaskID: tid, Unique: action}, false, nil
+	}
+	return BatchItem{TaskID: tasker.GetID()}, true, nil
+}
+
+// release 推送失败时释放幂等键和唯一键, 允许生产者重试
+func (s *HttpServer) release(tasker task.Tasker) {
+	s.forget(tasker)
+	key := store.UniqueKeyOf(tasker)
+	if us, ok := s.TaskStore.(store.UniqueTaskStorer); ok && key != "" {
+		_ = us.Unlock(tasker.GetAppID(), key, tasker.GetID())
+	}
+}
+
+// unique 处理带唯一键的任务
+// 没有同键待执行任务时由新任务持有锁并返回空, 由调用方入队; 否则按策略处理已有任务, 返回已有任务ID和策略
+func (s *HttpServer) unique(tasker task.Tasker) (string, string, error) {
+	key := store.UniqueKeyOf(tasker)
+	if key == "" {
+		return "", "", nil
+	}
+	us, ok := s.TaskStore.(store.UniqueTaskStorer)
+	if !ok {
+		return "", "", errUniqueNotSupport
+	}
+	appId, tid := tasker.GetAppID(), tasker.GetID()
+	lifetime := time.Until(time.Unix(tasker.GetExpectTime(), 0)) + UniqueLockTime
+	for i := 0; i < uniqueRetryTimes; i++ {
+		holder, ok, err := us.Lock(appId, key, tid, lifetime)
+		if err != nil {
+			return "", "", err
+		}
+		if ok {
+			//锁已过期时, 任务处理区中可能仍有同键任务等待重试
+			holder, err = s.uniqueProcess(appId, key)
+			if err != nil {
+				_ = us.Unlock(appId, key, tid)
+				return "", "", err
+			}
+			if holder == "" {
+				return "", "", nil
+			}
+			ok, err := us.Relock(appId, key, tid, holder, lifetime)
+			if err != nil {
+				_ = us.Unlock(appId, key, tid)
+				return "", "", err
+			}
+			if !ok {
+				continue
+			}
+		}
+		status, err := s.pending(holder)
+		if err != nil {
+			return "", "", err
+		}
+		if status == nil {
+			//已有任务已开始执行或已结束, 由新任务持有锁
+			ok, err := us.Relock(appId, key, holder, tid, lifetime)
+			if err != nil {
+				return "", "", err
+			}
+			if ok {
+				return "", "", nil
+			}
+			continue
+		}
+		policy, applied, err := s.resolve(tasker, holder, status.NextTime)
+		if err != nil {
+			return "", "", err
+		}
+		if applied {
+			return holder, policy, nil
+		}
+		//修改时已有任务已被取出, 重新竞争锁
+	}
+	return "", "", errUniqueConflict
+}
+
+// uniqueProcess 从任务处理区按唯一键查找待执行的任务ID
+func (s *HttpServer) uniqueProcess(appId, key string) (string, error) {
+	ps, ok := s.ProcessStore.(store.UniqueProcessStorer)
+	if !ok {
+		return "", nil
+	}
+	v, err := ps.Unique(appId, key)
+	if err != nil || v == nil {
+		return "", err
+	}
+	status, err := s.pending(v.TID)
+	if err != nil || status == nil {
+		return "", err
+	}
+	return v.TID, nil
+}
+
+// pending 查询待执行(队列中、延时中或等待重试)任务的状态, 其他状态返回nil
+func (s *HttpServer) pending(tid string) (*TaskStatus, error) {
+	status := &TaskStatus{TaskID: tid}
+	found, err := s.statusFromProcess(status)
+	if err == nil && !found {
+		found, err = s.statusFromQueue(status)
+	}
+	if err != nil || !found {
+		return nil, err
+	}
+	switch status.State {
+	case TaskStateQueued, TaskStateScheduled, TaskStateRetrying:
+		return status, nil
+	}
+	return nil, nil
+}
+
+// resolve 按新任务的唯一键策略处理已有的待执行任务, next为已有任务的下次执行时间
+func (s *HttpServer) resolve(tasker task.Tasker, holder string, next int64) (string, bool, error) {
+	policy := tasker.(task.Unique).GetUniquePolicy()
+	p := task.Patch{}
+	switch policy {
+	case task.UniqueReplace:
+		//整体替换已有任务的内容, 与修改任务相同在数据源中比较更新
+		p.Task = tasker
+	case task.UniqueExtend:
+		at := tasker.GetExpectTime()
+		if at <= next {
+			return policy, true, nil
+		}
+		p.ExpectTime = &at
+	default:
+		return task.UniqueDrop, true, nil
+	}
+	n, err := s.patch(holder, p)
+	if err != nil {
+		return policy, false, err
+	}
+	return policy, n == store.PatchApplied, nil
+}
+
+// dedupeCode 去重处理错误对应的错误码
+func dedupeCode(err error) int {
+	switch {
+	case errors.Is(err, errIdempotentNotSupport), errors.Is(err, errUniqueNotSupport):
+		return errCodeNotSupport
+	case errors.Is(err, store.ErrPatchInvalid), errors.Is(err, store.ErrPatchNotSupport):
+		return errCodeParams
+	}
+	return errCodeStore
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+)
+
+// TestUniqueHeld 已被消费者取出、在时间轮中等待执行的同键任务可以被替换, 替换后消费者不再执行旧任务
+func TestUniqueHeld(t *testing.T) {
+	s, h := newTestServer()
+	first := call(t, h, http.MethodPost, "/api/task/http",
+		`{"app_id": "100", "url": "http://example.com/v1", "expect_time": 600, "unique_key": "k"}`)
+	tid, _ := first.Data["task_id"].(string)
+	if first.Code != 0 || tid == "" {
+		t.Fatalf("push = %d %s", first.Code, first.Message)
+	}
+
+	//模拟消费者取出任务放入时间轮
+	item, err := s.TaskStore.LPop()
+	if err != nil || item == nil {
+		t.Fatalf("LPop() = %v, %v", item, err)
+	}
+	item.SetProcessing()
+	if err := s.ProcessStore.Insert("c1", item); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		body   string
+		action string
+	}{
+		{"replace", `{"app_id": "100", "url": "http://example.com/v2", "expect_time": 900, "unique_key": "k", "unique_policy": "replace"}`, "replace"},
+		{"extend", `{"app_id": "100", "url": "http://example.com/v3", "expect_time": 1200, "unique_key": "k", "unique_policy": "extend"}`, "extend"},
+		{"drop", `{"app_id": "100", "url": "http://example.com/v4", "unique_key": "k"}`, "drop"},
+	}
+	for _, c := range cases {
+		resp := call(t, h, http.MethodPost, "/api/task/http", c.body)
+		if resp.Code != 0 {
+			t.Fatalf("%s: code = %d %s", c.name, resp.Code, resp.Message)
+		}
+		if resp.Data["task_id"] != tid || resp.Data["unique"] != c.action {
+			t.Errorf("%s: data = %v, want %s of %s", c.name, resp.Data, c.action, tid)
+		}
+	}
+
+	v, err := s.ProcessStore.(store.FindProcessStorer).Find(tid)
+	if err != nil || v == nil {
+		t.Fatalf("Find() = %v, %v", v, err)
+	}
+	patched, _ := store.Decode(v.Task)
+	if patched.GetContent() == item.GetContent() || v.LockStatus != 0 {
+		t.Errorf("held task not patched: %v, lock_status %d", patched, v.LockStatus)
+	}
+	if ok, err := s.ProcessStore.(store.ClaimProcessStorer).Claim("c1", tid); err != nil || ok {
+		t.Errorf("Claim() after patch = %v, %v, want false", ok, err)
+	}
+}
+
+// TestUniqueReplace replace策略替换已有任务的全部参数, 不能修改优先级
+func TestUniqueReplace(t *testing.T) {
+	s, h := newTestServer()
+	first := call(t, h, http.MethodPost, "/api/task/http",
+		`{"app_id": "100", "url": "http://example.com/v1", "expect_time": 600, "unique_key": "k"}`)
+	tid, _ := first.Data["task_id"].(string)
+	if first.Code != 0 || tid == "" {
+		t.Fatalf("push = %d %s", first.Code, first.Message)
+	}
+
+	resp := call(t, h, http.MethodPost, "/api/task/http", `{"app_id": "100", "url": "http://example.com/v2", "method": "POST",
+		"headers": {"X-Version": "2"}, "timeout": 30, "unique_key": "k", "unique_policy": "replace"}`)
+	if resp.Code != 0 || resp.Data["task_id"] != tid || resp.Data["unique"] != "replace" {
+		t.Fatalf("replace = %d %s %v", resp.Code, resp.Message, resp.Data)
+	}
+	item, _, err := s.TaskStore.(store.LookupTaskStorer).Lookup(tid)
+	if err != nil || item == nil {
+		t.Fatalf("Lookup() = %v, %v", item, err)
+	}
+	v := item.(*task.HttpTask)
+	if v.ID != tid || v.URL != "http://example.com/v2" || v.Method != "POST" || v.Headers["X-Version"] != "2" || v.ExecTimeout != 30 {
+		t.Errorf("replaced task = %+v", v)
+	}
+
+	resp = call(t, h, http.MethodPost, "/api/task/http",
+		`{"app_id": "100", "url": "http://example.com/v3", "priority": 5, "unique_key": "k", "unique_policy": "replace"}`)
+	if resp.Code != errCodeParams {
+		t.Errorf("replace with other priority code = %d, want %d", resp.Code, errCodeParams)
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+	"github.com/meixiu/utask/workflow"
+
+	"github.com/gin-gonic/gin"
+)
+
+// workflowStatus 工作流状态名
+var workflowStatus = map[int]string{
+	store.WorkflowRunning:   "running",
+	store.WorkflowSucceeded: "succeeded",
+	store.WorkflowFailed:    "failed",
+}
+
+// nodeStatus 工作流节点状态名
+var nodeStatus = map[int]string{
+	store.NodeWaiting:   "waiting",
+	store.NodePushed:    "pushed",
+	store.NodeSucceeded: "succeeded",
+	store.NodeFailed:    "failed",
+	store.NodeSkipped:   "skipped",
+}
+
+// Workflow 工作流信息
+type Workflow struct {
+	WorkflowID string         `json:"workflow_id"`
+	AppID      string         `json:"app_id"`
+	Name       string         `json:"name"`
+	Status     string         `json:"status"` // running|succeeded|failed
+	Error      string         `json:"error"`
+	Nodes      []WorkflowNode `json:"nodes"`
+	CreateTime int64          `json:"create_time"`
+	UpdateTime int64          `json:"update_time"`
+}
+
+// WorkflowNode 工作流节点信息
+type WorkflowNode struct {
+	Name       string   `json:"name"`
+	Depends    []string `json:"depends"`
+	TaskID     string   `json:"task_id"` // 节点推送后的任务ID
+	Content    string   `json:"content"`
+	Status     string   `json:"status"` // waiting|pushed|succeeded|failed|skipped
+	UpdateTime int64    `json:"update_time"`
+}
+
+// DataWorkflow 工作流参数
+type DataWorkflow struct {
+	AppID string             `json:"app_id" binding:"required"`
+	Name  string             `json:"name"`
+	Type  string             `json:"type"` // 节点任务类型, 默认为http
+	Nodes []DataWorkflowNode `json:"nodes" binding:"required"`
+}
+
+// DataWorkflowNode 工作流节点参数
+type DataWorkflowNode struct {
+	Name    string          `json:"name" binding:"required"`
+	Depends []string        `json:"depends"` // 依赖的节点名称, 全部执行成功后推送
+	Task    json.RawMessage `json:"task" binding:"required"`
+}
+
+// AddWorkflow create a workflow and push nodes without depends
+func (s *HttpServer) AddWorkflow(ctx *gin.Context) {
+	if s.WorkflowStore == nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: workflow.ErrNotSupport.Error()})
+		return
+	}
+	data := &DataWorkflow{}
+	if err := ctx.ShouldBindJSON(data); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeDataBind, Message: "data bind error"})
+		return
+	}
+	if data.Type == "" {
+		data.Type = "http"
+	}
+	nodes := make([]workflow.Node, 0, len(data.Nodes))
+	for _, v := range data.Nodes {
+		tasker := task.Lookup(data.Type)
+		if tasker == nil {
+			ctx.JSON(http.StatusOK, HttpResp{Code: errCodeDataType, Message: "data type error"})
+			return
+		}
+		if err := json.Unmarshal(v.Task, tasker); err != nil {
+			ctx.JSON(http.StatusOK, HttpResp{Code: errCodeDataBind, Message: "data bind error"})
+			return
+		}
+		if err := s.validate(tasker); err != nil {
+			ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: err.Error()})
+			return
+		}
+		nodes = append(nodes, workflow.Node{Name: v.Name, Depends: v.Depends, Task: tasker})
+	}
+	if err := workflow.Validate(data.AppID, nodes); err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: err.Error()})
+		return
+	}
+	wf, err := s.workflow().Create(data.AppID, data.Name, nodes)
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodePushQueue, Message: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"workflow_id": wf.WorkflowID,
+		},
+	})
+	return
+}
+
+// WorkflowInfo workflow status and nodes
+func (s *HttpServer) WorkflowInfo(ctx *gin.Context) {
+	if s.WorkflowStore == nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeNotSupport, Message: workflow.ErrNotSupport.Error()})
+		return
+	}
+	wf, nodes, err := s.WorkflowStore.GetWorkflow(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeStore, Message: err.Error()})
+		return
+	}
+	if wf == nil {
+		ctx.JSON(http.StatusOK, HttpResp{Code: errCodeParams, Message: "workflow not found"})
+		return
+	}
+	ctx.JSON(http.StatusOK, HttpResp{
+		Code:    0,
+		Message: "success",
+		Data:    newWorkflow(*wf, nodes),
+	})
+	return
+}
+
+// workflow 返回使用当前数据源的工作流执行器
+func (s *HttpServer) workflow() *workflow.Runner {
+	return workflow.NewRunner(s.ID, workflow.NewOptions(
+		workflow.TaskStore(s.TaskStore),
+		workflow.WorkflowStore(s.WorkflowStore),
+	))
+}
+
+// newWorkflow 转换工作流区的工作流为工作流信息
+func newWorkflow(v store.TaskWorkflow, nodes []store.TaskWorkflowNode) Workflow {
+	wf := Workflow{
+		WorkflowID: v.WorkflowID,
+		AppID:      v.AppID,
+		Name:       v.Name,
+		Status:     workflowStatus[v.Status],
+		Error:      store.Plaintext(v.Error),
+		Nodes:      make([]WorkflowNode, 0, len(nodes)),
+		CreateTime: v.CreateTime,
+		UpdateTime: v.UpdateTime,
+	}
+	for _, n := range nodes {
+		depends := make([]string, 0)
+		if n.Depends != "" {
+			depends = strings.Split(n.Depends, ",")
+		}
+		wf.Nodes = append(wf.Nodes, WorkflowNode{
+			Name:       n.Name,
+			Depends:    depends,
+			TaskID:     n.TID,
+			Content:    store.Plaintext(n.Content),
+			Status:     nodeStatus[n.Status],
+			UpdateTime: n.UpdateTime,
+		})
+	}
+	return wf
+}
@@ -9,3 +9,9 @@ type Coder interface {
 	// Decode 将二进制数据反序列化
 	Decode([]byte) (task.Tasker, error)
 }
+
+// Preferrer 能判断数据是否已是首选格式的编码器, 用于改写已存储的数据
+type Preferrer interface {
+	// IsPreferred 判断数据是否已是首选格式
+	IsPreferred([]byte) bool
+}
@@ -0,0 +1,58 @@
+package coder
+
+import (
+	"github.com/meixiu/utask/task"
+)
+
+// CryptoCoder 是对编码后的任务数据进行AES-GCM加密的
+// 读取时兼容未加密的旧数据和旧密钥加密的数据
+type CryptoCoder struct {
+	coder   Coder
+	keyring *Keyring
+}
+
+// NewCryptoCoder 返回一个使用keyring加密coder编码结果的CryptoCoder对象
+func NewCryptoCoder(coder Coder, keyring *Keyring) *CryptoCoder {
+	return &CryptoCoder{
+		coder:   coder,
+		keyring: keyring,
+	}
+}
+
+// Encode 序列化并加密一个任务
+func (c CryptoCoder) Encode(task task.Tasker) ([]byte, error) {
+	data, err := c.coder.Encode(task)
+	if err != nil {
+		return nil, err
+	}
+	return c.keyring.Seal(data)
+}
+
+// Decode 解密并反序列化出一个任务, 未加密的数据直接反序列化
+func (c CryptoCoder) Decode(data []byte) (task.Tasker, error) {
+	if !IsSealed(data) {
+		return c.coder.Decode(data)
+	}
+	plain, err := c.keyring.Open(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.coder.Decode(plain)
+}
+
+// IsPreferred 判断数据是否已使用当前密钥加密, 且内层编码为首选格式
+func (c CryptoCoder) IsPreferred(data []byte) bool {
+	id, ok := KeyID(data)
+	if !ok || id != c.keyring.Current() {
+		return false
+	}
+	p, ok := c.coder.(Preferrer)
+	if !ok {
+		return true
+	}
+	plain, err := c.keyring.Open(data)
+	if err != nil {
+		return false
+	}
+	return p.IsPreferred(plain)
+}
@@ -0,0 +1,80 @@
+package coder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/meixiu/utask/task"
+)
+
+func TestKeyring(t *testing.T) {
+	k1 := bytes.Repeat([]byte{1}, 16)
+	k2 := bytes.Repeat([]byte{2}, 32)
+	old, err := NewKeyring("k1", map[string][]byte{"k1": k1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": k1, "k2": k2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := old.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := KeyID(sealed); !ok || id != "k1" {
+		t.Fatalf("KeyID() = %q, %v, want k1", id, ok)
+	}
+	//轮换后仍能读取旧密钥加密的数据
+	plain, err := rotated.Open(sealed)
+	if err != nil || string(plain) != "secret" {
+		t.Fatalf("Open() = %q, %v", plain, err)
+	}
+	sealed, _ = rotated.Seal([]byte("secret"))
+	if _, err := old.Open(sealed); err == nil {
+		t.Error("Open() with unknown key succeeded")
+	}
+	sealed[len(sealed)-1] ^= 0xff
+	if _, err := rotated.Open(sealed); err == nil {
+		t.Error("Open() of tampered data succeeded")
+	}
+
+	cases := []struct {
+		name    string
+		current string
+		keys    map[string][]byte
+	}{
+		{"missing current", "k3", map[string][]byte{"k1": k1}},
+		{"bad key size", "k1", map[string][]byte{"k1": []byte("short")}},
+		{"empty id", "", map[string][]byte{"": k1}},
+	}
+	for _, c := range cases {
+		if _, err := NewKeyring(c.current, c.keys); err == nil {
+			t.Errorf("%s: NewKeyring() err = nil", c.name)
+		}
+	}
+}
+
+func TestCryptoCoder(t *testing.T) {
+	k, _ := NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 16)})
+	c := NewCryptoCoder(multiCoder(t, FormatJson), k)
+	item := &task.HttpTask{ID: "t1", AppID: "100"}
+	//未加密的旧数据直接读取
+	plain, _ := NewGobCoder().Encode(item)
+	if got, err := c.Decode(plain); err != nil || got.GetID() != "t1" {
+		t.Fatalf("Decode(plain) = %v, %v", got, err)
+	}
+	if c.IsPreferred(plain) {
+		t.Error("IsPreferred(plain) = true")
+	}
+	sealed, err := c.Encode(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || !c.IsPreferred(sealed) {
+		t.Error("Encode() is not sealed with the current key")
+	}
+	if got, err := c.Decode(sealed); err != nil || got.GetID() != "t1" {
+		t.Fatalf("Decode(sealed) = %v, %v", got, err)
+	}
+}
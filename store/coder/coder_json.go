@@ -0,0 +1,53 @@
+package coder
+
+import (
+	"encoding/json"
+
+	"github.com/meixiu/utask/task"
+)
+
+// jsonEnvelope JSON序列化的任务信封
+type jsonEnvelope struct {
+	Type    string          `json:"type"`    // 任务类型
+	Version int             `json:"version"` // 任务结构版本
+	Payload json.RawMessage `json:"payload"` // 任务数据
+}
+
+// JsonCoder 是实现对任务进行JSON序列化、反序列化的
+// 任务数据外包装一层带任务类型和结构版本的信封, 反序列化时通过task.Lookup创建任务
+type JsonCoder struct {
+}
+
+// NewJsonCoder 返回一个JsonCoder对象
+func NewJsonCoder() *JsonCoder {
+	return &JsonCoder{}
+}
+
+// Encode 使用JSON序列化一个任务
+func (c JsonCoder) Encode(task task.Tasker) ([]byte, error) {
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonEnvelope{
+		Type:    task.GetType(),
+		Version: schemaVersion(task),
+		Payload: payload,
+	})
+}
+
+// Decode 使用JSON反序列化出一个任务
+func (c JsonCoder) Decode(data []byte) (task task.Tasker, err error) {
+	env := jsonEnvelope{}
+	if err = json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	task, err = lookup(env.Type, env.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(env.Payload, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
@@ -0,0 +1,61 @@
+package coder
+
+import (
+	"github.com/meixiu/utask/task"
+
+	"github.com/ugorji/go/codec"
+)
+
+// msgpackEnvelope MessagePack序列化的任务信封
+type msgpackEnvelope struct {
+	Type    string    `codec:"type"`    // 任务类型
+	Version int       `codec:"version"` // 任务结构版本
+	Payload codec.Raw `codec:"payload"` // 任务数据
+}
+
+// MsgpackCoder 是实现对任务进行MessagePack序列化、反序列化的
+// 任务数据外包装一层带任务类型和结构版本的信封, 反序列化时通过task.Lookup创建任务
+type MsgpackCoder struct {
+	handle *codec.MsgpackHandle
+}
+
+// NewMsgpackCoder 返回一个MsgpackCoder对象
+func NewMsgpackCoder() *MsgpackCoder {
+	h := &codec.MsgpackHandle{}
+	h.WriteExt = true
+	h.Raw = true
+	return &MsgpackCoder{handle: h}
+}
+
+// Encode 使用MessagePack序列化一个任务
+func (c MsgpackCoder) Encode(task task.Tasker) (data []byte, err error) {
+	var payload []byte
+	if err = codec.NewEncoderBytes(&payload, c.handle).Encode(task); err != nil {
+		return nil, err
+	}
+	err = codec.NewEncoderBytes(&data, c.handle).Encode(msgpackEnvelope{
+		Type:    task.GetType(),
+		Version: schemaVersion(task),
+		Payload: payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Decode 使用MessagePack反序列化出一个任务
+func (c MsgpackCoder) Decode(data []byte) (task task.Tasker, err error) {
+	env := msgpackEnvelope{}
+	if err = codec.NewDecoderBytes(data, c.handle).Decode(&env); err != nil {
+		return nil, err
+	}
+	task, err = lookup(env.Type, env.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err = codec.NewDecoderBytes(env.Payload, c.handle).Decode(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
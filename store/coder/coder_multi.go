@@ -0,0 +1,79 @@
+package coder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/meixiu/utask/task"
+)
+
+const (
+	// FormatGob gob编码, 旧版本的默认格式
+	FormatGob = "gob"
+	// FormatJson 带信封的JSON编码
+	FormatJson = "json"
+	// FormatMsgpack 带信封的MessagePack编码
+	FormatMsgpack = "msgpack"
+)
+
+// Format 识别数据的编码格式
+// JSON信封以'{'开头, MessagePack信封以fixmap(0x80-0x8f)开头, gob消息的首字节是长度, 不会落在fixmap范围
+// gob消息长度为123时首字节同样是'{', 因此还需要校验是否为合法JSON
+func Format(data []byte) string {
+	b := bytes.TrimLeft(data, " \t\r\n")
+	switch {
+	case len(b) > 0 && b[0] == '{' && json.Valid(b):
+		return FormatJson
+	case len(data) > 0 && data[0] >= 0x80 && data[0] <= 0x8f:
+		return FormatMsgpack
+	default:
+		return FormatGob
+	}
+}
+
+// MultiCoder 是识别数据格式进行反序列化, 使用首选格式序列化的
+// 用于切换编码格式时兼容已存储的任务数据
+type MultiCoder struct {
+	format string
+	coders map[string]Coder
+}
+
+// NewMultiCoder 返回一个首选format格式的MultiCoder对象, format为空时使用gob, 未知格式返回错误
+func NewMultiCoder(format string) (*MultiCoder, error) {
+	if format == "" {
+		format = FormatGob
+	}
+	c := &MultiCoder{
+		format: format,
+		coders: map[string]Coder{
+			FormatGob:     NewGobCoder(),
+			FormatJson:    NewJsonCoder(),
+			FormatMsgpack: NewMsgpackCoder(),
+		},
+	}
+	if _, ok := c.coders[format]; !ok {
+		return nil, fmt.Errorf("unknown coder %q", format)
+	}
+	return c, nil
+}
+
+// Format 首选的编码格式
+func (c MultiCoder) Format() string {
+	return c.format
+}
+
+// IsPreferred 判断数据是否已是首选格式
+func (c MultiCoder) IsPreferred(data []byte) bool {
+	return Format(data) == c.format
+}
+
+// Encode 使用首选格式序列化一个任务
+func (c MultiCoder) Encode(task task.Tasker) ([]byte, error) {
+	return c.coders[c.format].Encode(task)
+}
+
+// Decode 识别数据格式反序列化出一个任务
+func (c MultiCoder) Decode(data []byte) (task.Tasker, error) {
+	return c.coders[Format(data)].Decode(data)
+}
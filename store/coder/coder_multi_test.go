@@ -0,0 +1,92 @@
+package coder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/meixiu/utask/task"
+)
+
+func TestFormat(t *testing.T) {
+	item := &task.HttpTask{ID: "t1", AppID: "100", URL: "http://example.com"}
+	cases := []struct {
+		coder Coder
+		want  string
+	}{
+		{NewGobCoder(), FormatGob},
+		{NewJsonCoder(), FormatJson},
+		{NewMsgpackCoder(), FormatMsgpack},
+	}
+	for _, c := range cases {
+		data, err := c.coder.Encode(item)
+		if err != nil {
+			t.Fatalf("%s: Encode() err: %v", c.want, err)
+		}
+		if got := Format(data); got != c.want {
+			t.Errorf("Format(%s data) = %s", c.want, got)
+		}
+	}
+	//长度为123的gob消息首字节同样是'{'
+	if got := Format(append([]byte{'{'}, bytes.Repeat([]byte{0}, 123)...)); got != FormatGob {
+		t.Errorf("Format(gob with '{' length) = %s, want %s", got, FormatGob)
+	}
+}
+
+func TestMultiCoder(t *testing.T) {
+	item := &task.HttpTask{ID: "t1", AppID: "100", URL: "http://example.com", Body: "{}"}
+	formats := []string{FormatGob, FormatJson, FormatMsgpack}
+	for _, from := range formats {
+		data, err := multiCoder(t, from).Encode(item)
+		if err != nil {
+			t.Fatalf("%s: Encode() err: %v", from, err)
+		}
+		for _, to := range formats {
+			c := multiCoder(t, to)
+			got, err := c.Decode(data)
+			if err != nil {
+				t.Fatalf("%s -> %s: Decode() err: %v", from, to, err)
+			}
+			if got.GetID() != item.ID || got.GetAppID() != item.AppID {
+				t.Errorf("%s -> %s: Decode() = %v, want %v", from, to, got, item)
+			}
+			if c.IsPreferred(data) != (from == to) {
+				t.Errorf("%s -> %s: IsPreferred() = %v", from, to, !(from == to))
+			}
+		}
+	}
+}
+
+func TestNewMultiCoder(t *testing.T) {
+	cases := []struct {
+		format string
+		want   string
+		ok     bool
+	}{
+		{"", FormatGob, true},
+		{FormatGob, FormatGob, true},
+		{FormatJson, FormatJson, true},
+		{FormatMsgpack, FormatMsgpack, true},
+		{"JSON", "", false},
+		{"protobuf", "", false},
+	}
+	for _, c := range cases {
+		got, err := NewMultiCoder(c.format)
+		if (err == nil) != c.ok {
+			t.Errorf("NewMultiCoder(%q) err = %v, want ok %v", c.format, err, c.ok)
+			continue
+		}
+		if c.ok && got.Format() != c.want {
+			t.Errorf("NewMultiCoder(%q).Format() = %s, want %s", c.format, got.Format(), c.want)
+		}
+	}
+}
+
+// multiCoder 返回首选format格式的MultiCoder
+func multiCoder(t *testing.T, format string) *MultiCoder {
+	t.Helper()
+	c, err := NewMultiCoder(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
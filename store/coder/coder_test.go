@@ -0,0 +1,56 @@
+package coder
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+
+	"github.com/meixiu/utask/task"
+)
+
+func init() {
+	gob.Register(&task.HttpTask{})
+}
+
+func TestCoder(t *testing.T) {
+	item := &task.HttpTask{ID: "t1", AppID: "100", URL: "http://example.com", Body: "{}", Priority: 5}
+	coders := map[string]Coder{
+		"gob":     NewGobCoder(),
+		"json":    NewJsonCoder(),
+		"msgpack": NewMsgpackCoder(),
+	}
+	for name, c := range coders {
+		data, err := c.Encode(item)
+		if err != nil {
+			t.Fatalf("%s: Encode() err: %v", name, err)
+		}
+		got, err := c.Decode(data)
+		if err != nil {
+			t.Fatalf("%s: Decode() err: %v", name, err)
+		}
+		v, ok := got.(*task.HttpTask)
+		if !ok || v.ID != item.ID || v.URL != item.URL || v.Body != item.Body || v.Priority != item.Priority {
+			t.Errorf("%s: Decode() = %v, want %v", name, got, item)
+		}
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	payload, _ := json.Marshal(&task.HttpTask{ID: "t1"})
+	cases := []struct {
+		name string
+		env  jsonEnvelope
+		ok   bool
+	}{
+		{"current", jsonEnvelope{Type: "http", Version: DefaultSchemaVersion, Payload: payload}, true},
+		{"older", jsonEnvelope{Type: "http", Version: 0, Payload: payload}, true},
+		{"newer", jsonEnvelope{Type: "http", Version: DefaultSchemaVersion + 1, Payload: payload}, false},
+		{"unknown type", jsonEnvelope{Type: "rpc", Version: DefaultSchemaVersion, Payload: payload}, false},
+	}
+	for _, c := range cases {
+		data, _ := json.Marshal(c.env)
+		if _, err := NewJsonCoder().Decode(data); (err == nil) != c.ok {
+			t.Errorf("%s: Decode() err = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package coder
+
+import (
+	"fmt"
+
+	"github.com/meixiu/utask/task"
+)
+
+// DefaultSchemaVersion 未实现Versioner的任务结构版本
+const DefaultSchemaVersion = 1
+
+// Versioner 任务结构有不兼容变更时实现, 返回当前的结构版本
+type Versioner interface {
+	SchemaVersion() int
+}
+
+// schemaVersion 获取任务的结构版本
+func schemaVersion(t task.Tasker) int {
+	if v, ok := t.(Versioner); ok {
+		return v.SchemaVersion()
+	}
+	return DefaultSchemaVersion
+}
+
+// lookup 根据信封中的任务类型和结构版本创建一个空任务
+func lookup(typ string, version int) (task.Tasker, error) {
+	t := task.Lookup(typ)
+	if t == nil {
+		return nil, fmt.Errorf("coder: unknown task type %q", typ)
+	}
+	if current := schemaVersion(t); version > current {
+		return nil, fmt.Errorf("coder: task %q version %d is newer than %d", typ, version, current)
+	}
+	return t, nil
+}
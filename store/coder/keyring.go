@@ -0,0 +1,107 @@
+package coder
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// sealMagic 密文前缀, 首字节不会与gob、JSON、MessagePack信封的首字节冲突
+var sealMagic = []byte{0xe5, 'U', 'T', '1'}
+
+// Keyring 是带密钥ID的AES-GCM密钥环
+// 使用当前密钥加密, 按密文中记录的密钥ID选择密钥解密, 轮换密钥时保留旧密钥即可读取旧数据
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring 返回一个Keyring对象, keys的值为16、24或32字节的AES密钥
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{
+		current: current,
+		aeads:   make(map[string]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("keyring: invalid key id %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: key %q: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: key %q: %v", id, err)
+		}
+		k.aeads[id] = aead
+	}
+	if _, ok := k.aeads[current]; !ok {
+		return nil, fmt.Errorf("keyring: current key %q not found", current)
+	}
+	return k, nil
+}
+
+// Current 当前用于加密的密钥ID
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Seal 使用当前密钥加密
+// 密文格式: 前缀 | 密钥ID长度(1字节) | 密钥ID | nonce | 密文, 前缀和密钥ID作为附加数据参与认证
+func (k *Keyring) Seal(plain []byte) ([]byte, error) {
+	aead := k.aeads[k.current]
+	header := make([]byte, 0, len(sealMagic)+1+len(k.current))
+	header = append(header, sealMagic...)
+	header = append(header, byte(len(k.current)))
+	header = append(header, k.current...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(header)+len(nonce)+len(plain)+aead.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plain, header), nil
+}
+
+// Open 按密文中的密钥ID选择密钥解密
+func (k *Keyring) Open(data []byte) ([]byte, error) {
+	id, ok := KeyID(data)
+	if !ok {
+		return nil, errors.New("keyring: data is not sealed")
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("keyring: unknown key %q", id)
+	}
+	n := len(sealMagic) + 1 + len(id)
+	if len(data) < n+aead.NonceSize() {
+		return nil, errors.New("keyring: data too short")
+	}
+	nonce := data[n : n+aead.NonceSize()]
+	return aead.Open(nil, nonce, data[n+aead.NonceSize():], data[:n])
+}
+
+// IsSealed 判断数据是否为Keyring加密的密文
+func IsSealed(data []byte) bool {
+	_, ok := KeyID(data)
+	return ok
+}
+
+// KeyID 解析密文使用的密钥ID
+func KeyID(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, sealMagic) || len(data) < len(sealMagic)+1 {
+		return "", false
+	}
+	n := int(data[len(sealMagic)])
+	if n == 0 || len(data) < len(sealMagic)+1+n {
+		return "", false
+	}
+	return string(data[len(sealMagic)+1 : len(sealMagic)+1+n]), true
+}
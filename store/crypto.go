@@ -0,0 +1,93 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/meixiu/utask/app"
+	"github.com/meixiu/utask/log"
+	"github.com/meixiu/utask/store/coder"
+)
+
+const (
+	// ColumnsPlain content、result、error列写入明文
+	ColumnsPlain = "plain"
+	// ColumnsEncrypt content、result、error列写入密文
+	ColumnsEncrypt = "encrypt"
+	// ColumnsOmit content、result、error列不写入
+	ColumnsOmit = "omit"
+
+	// textSealPrefix 加密文本列的前缀
+	textSealPrefix = "enc:"
+)
+
+// defaultKeyring 默认的密钥环, 未开启加密时为nil
+var defaultKeyring *coder.Keyring
+
+// newKeyring 根据crypto配置返回密钥环, 密钥为base64编码
+func newKeyring() (*coder.Keyring, error) {
+	keys := make(map[string][]byte, len(app.Config.Crypto.Keys))
+	for id, v := range app.Config.Crypto.Keys {
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("crypto key %q: %v", id, err)
+		}
+		keys[id] = key
+	}
+	return coder.NewKeyring(app.Config.Crypto.KeyID, keys)
+}
+
+// Readable 按crypto.columns配置处理写入content、result、error列的可读内容
+// 配置为encrypt但未开启加密时不写入
+func Readable(s string) string {
+	switch app.Config.Crypto.Columns {
+	case ColumnsOmit:
+		return ""
+	case ColumnsEncrypt:
+		if s == "" || strings.HasPrefix(s, textSealPrefix) {
+			return s
+		}
+		if defaultKeyring == nil {
+			return ""
+		}
+		data, err := defaultKeyring.Seal([]byte(s))
+		if err != nil {
+			log.Error("crypto seal err: ", err)
+			return ""
+		}
+		return textSealPrefix + base64.StdEncoding.EncodeToString(data)
+	default:
+		return s
+	}
+}
+
+// OpenText 解密Readable加密的内容, 未加密的内容原样返回
+func OpenText(s string) (string, error) {
+	if !strings.HasPrefix(s, textSealPrefix) {
+		return s, nil
+	}
+	if defaultKeyring == nil {
+		return "", errors.New("crypto is not enabled")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, textSealPrefix))
+	if err != nil {
+		return "", err
+	}
+	data, err = defaultKeyring.Open(data)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Plaintext 返回content、result、error列的明文用于展示, 解密失败时返回空
+func Plaintext(s string) string {
+	text, err := OpenText(s)
+	if err != nil {
+		log.Error("crypto open err: ", err)
+		return ""
+	}
+	return text
+}
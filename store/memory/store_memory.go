@@ -0,0 +1,1033 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/meixiu/utask/log"
+	"github.com/meixiu/utask/pkg/randstr"
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+)
+
+// Store 是内存实现的taskStore，processStore，logStore，secretStore，scheduleStore，workflowStore
+// 适用于单元测试和单机部署，进程退出后数据全部丢失
+type Store struct {
+	mu      sync.Mutex
+	queue   []queued          // 任务队列, 按优先级降序
+	delayed []delayed         // 调度区, 按到期时间升序
+	items   []*store.TaskItem // 任务处理区
+	logs    []*store.TaskLog  // 任务日志区
+	tokens  map[string]token  // 任务token
+	idem    map[string]token  // 幂等键 业务ID:幂等键 -> 任务ID
+	unique  map[string]token  // 唯一键锁 业务ID:唯一键 -> 任务ID
+	leaders map[string]token  // 执行者 name -> 执行者ID
+	autoID  int               // 自增ID
+
+	schedules []*store.TaskSchedule     // 周期任务计划
+	workflows []*store.TaskWorkflow     // 工作流
+	nodes     []*store.TaskWorkflowNode // 工作流节点
+
+	cancelled map[string]time.Time // 已取消任务 tid -> 标记过期时间
+	running   map[string]time.Time // 执行中任务 tid -> 标记过期时间
+}
+
+// queued 队列中的任务
+type queued struct {
+	priority int
+	data     []byte
+}
+
+// delayed 调度区中的任务
+type delayed struct {
+	at int64
+	queued
+}
+
+// token 带过期时间的任务token
+type token struct {
+	value    string
+	expireAt time.Time
+}
+
+// NewStore 返回一个新的内存Store对象
+func NewStore() *Store {
+	return &Store{
+		tokens:    make(map[string]token),
+		idem:      make(map[string]token),
+		unique:    make(map[string]token),
+		leaders:   make(map[string]token),
+		cancelled: make(map[string]time.Time),
+		running:   make(map[string]time.Time),
+	}
+}
+
+// LPop 从队列头部取出一个任务
+func (s *Store) LPop() (task.Tasker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return nil, nil
+	}
+	q := s.queue[0]
+	s.queue = s.queue[1:]
+	item, err := store.Decode(q.data)
+	if err != nil {
+		//与RedisStore一致, 解析失败的任务放回队列
+		s.enqueue(q)
+		return nil, err
+	}
+	log.Info("task pop: ", item)
+	return item, nil
+}
+
+// RPush 增加一个任务到同优先级任务的尾部
+func (s *Store) RPush(task task.Tasker) (bool, error) {
+	data, err := store.Encode(task)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	s.enqueue(queued{priority: store.PriorityOf(task), data: data})
+	s.mu.Unlock()
+	log.Info("task push: ", task)
+	return true, nil
+}
+
+// RPushBatch 批量增加任务到同优先级任务的尾部
+func (s *Store) RPushBatch(tasks []task.Tasker) ([]error, error) {
+	errs := make([]error, len(tasks))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, task := range tasks {
+		data, err := store.Encode(task)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		s.enqueue(queued{priority: store.PriorityOf(task), data: data})
+		log.Info("task push: ", task)
+	}
+	return errs, nil
+}
+
+// Confirm 二次确认, 内存队列出队即确认
+func (s *Store) Confirm(tid string) error {
+	return nil
+}
+
+// Delay 将任务加入调度区, 在at时间到期
+func (s *Store) Delay(task task.Tasker, at int64) (bool, error) {
+	data, err := store.Encode(task)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.delayed), func(i int) bool {
+		return s.delayed[i].at > at
+	})
+	s.delayed = append(s.delayed, delayed{})
+	copy(s.delayed[i+1:], s.delayed[i:])
+	s.delayed[i] = delayed{at: at, queued: queued{priority: store.PriorityOf(task), data: data}}
+	log.Info("task delay: ", task, at)
+	return true, nil
+}
+
+// Promote 将until之前到期的最多size个任务移回队列
+func (s *Store) Promote(until int64, size int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for n < len(s.delayed) && n < size && s.delayed[n].at <= until {
+		s.enqueue(s.delayed[n].queued)
+		n++
+	}
+	s.delayed = s.delayed[n:]
+	return int64(n), nil
+}
+
+// Lookup 查询队列或调度区中的任务
+func (s *Store) Lookup(tid string) (task.Tasker, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.queue {
+		item, err := store.Decode(v.data)
+		if err == nil && item.GetID() == tid {
+			return item, 0, nil
+		}
+	}
+	for _, v := range s.delayed {
+		item, err := store.Decode(v.data)
+		if err == nil && item.GetID() == tid {
+			return item, v.at, nil
+		}
+	}
+	return nil, 0, nil
+}
+
+// Cancel 从队列和调度区移除任务并标记为已取消, 任务正在执行时返回CancelRunning
+func (s *Store) Cancel(tid string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if at, ok := s.running[tid]; ok && now.Before(at) {
+		return store.CancelRunning, nil
+	}
+	var found task.Tasker
+	var foundAt int64
+	queue := s.queue[:0]
+	for _, v := range s.queue {
+		if item, err := store.Decode(v.data); err == nil && item.GetID() == tid {
+			found = item
+			continue
+		}
+		queue = append(queue, v)
+	}
+	s.queue = queue
+	delayed := s.delayed[:0]
+	for _, v := range s.delayed {
+		if item, err := store.Decode(v.data); err == nil && item.GetID() == tid {
+			found, foundAt = item, v.at
+			continue
+		}
+		delayed = append(delayed, v)
+	}
+	s.delayed = delayed
+	s.cancelled[tid] = now.Add(store.CancelTimeOf(found, foundAt))
+	if found != nil {
+		return store.CancelRemoved, nil
+	}
+	return store.CancelMarked, nil
+}
+
+// Acquire 标记任务开始执行, 任务已取消时返回false
+func (s *Store) Acquire(tid string, lifetime time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if at, ok := s.cancelled[tid]; ok && now.Before(at) {
+		return false, nil
+	}
+	delete(s.cancelled, tid)
+	s.running[tid] = now.Add(lifetime)
+	return true, nil
+}
+
+// Release 清除任务的执行标记
+func (s *Store) Release(tid string) error {
+	s.mu.Lock()
+	delete(s.running, tid)
+	s.mu.Unlock()
+	return nil
+}
+
+// Patch 修改队列、调度区或任务处理区中未被锁定的任务
+func (s *Store) Patch(tid string, p task.Patch) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.queue {
+		item, err := store.Decode(v.data)
+		if err != nil || item.GetID() != tid {
+			continue
+		}
+		data, err := patch(item, p)
+		if err != nil {
+			return store.PatchNotFound, err
+		}
+		s.queue[i].data = data
+		return store.PatchApplied, nil
+	}
+	for i, v := range s.delayed {
+		item, err := store.Decode(v.data)
+		if err != nil || item.GetID() != tid {
+			continue
+		}
+		data, err := patch(item, p)
+		if err != nil {
+			return store.PatchNotFound, err
+		}
+		at := item.GetExpectTime()
+		if item.GetNextTime() > at {
+			at = item.GetNextTime()
+		}
+		s.delayed = append(s.delayed[:i], s.delayed[i+1:]...)
+		j := sort.Search(len(s.delayed), func(j int) bool {
+			return s.delayed[j].at > at
+		})
+		s.delayed = append(s.delayed, delayed{})
+		copy(s.delayed[j+1:], s.delayed[j:])
+		s.delayed[j] = delayed{at: at, queued: queued{priority: v.priority, data: data}}
+		return store.PatchApplied, nil
+	}
+	now := time.Now().Unix()
+	for _, v := range s.items {
+		if v.TID != tid {
+			continue
+		}
+		if isDead(v, v.AppID) {
+			return store.PatchDead, nil
+		}
+		if v.LockStatus == 1 && v.LockTime >= now {
+			return store.PatchLeased, nil
+		}
+		item, err := store.Decode(v.Task)
+		if err != nil {
+			return store.PatchNotFound, err
+		}
+		store.UnsetProcessing(item)
+		data, err := patch(item, p)
+		if err != nil {
+			return store.PatchNotFound, err
+		}
+		v.Task = data
+		v.Content = store.Readable(item.GetContent())
+		v.LockStatus = 0
+		v.LockTime = store.LockTimeOf(item)
+		v.UpdateTime = now
+		return store.PatchApplied, nil
+	}
+	return store.PatchNotFound, nil
+}
+
+// Len 返回队列中等待的任务数
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Get 根据客户端、拉取个数从任务处理区拉取任务
+func (s *Store) Get(cid string, size int) (data []task.Tasker, err error) {
+	log.Info("task process get: ", cid, size)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lockTime := time.Now().Unix()
+
+	m := make([]*store.TaskItem, 0, size)
+	for _, v := range s.items {
+		if v.CID == cid && v.Times < store.MaxTimesOf(v) && v.LockTime < lockTime && v.LockStatus != store.LockStatusDead {
+			m = append(m, v)
+		}
+	}
+	sortByPriority(m)
+	if len(m) > size {
+		m = m[:size]
+	}
+	// 悲观获取, 与MysqlStore相同按任务超时时间加MaxLockTime租用, 未记录超时时间的任务按MaxLockTime租用
+	for _, v := range m {
+		lease := store.MaxLockTime
+		if v.Timeout > 0 {
+			lease += v.Timeout
+		}
+		v.LockStatus = 1
+		v.LockTime = lockTime + lease
+		v.Times++
+	}
+	for _, v := range m {
+		item, err := store.Decode(v.Task)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, item)
+	}
+	return data, nil
+}
+
+// Insert 插入一条任务到处理区
+func (s *Store) Insert(cid string, task task.Tasker) error {
+	log.Info("task process insert: ", task)
+	data, err := store.Encode(task)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoID++
+	s.items = append(s.items, &store.TaskItem{
+		ID:         s.autoID,
+		TID:        task.GetID(),
+		AppID:      task.GetAppID(),
+		Priority:   store.PriorityOf(task),
+		UniqueKey:  store.UniqueKeyOf(task),
+		Task:       data,
+		Content:    store.Readable(task.GetContent()),
+		Result:     "",
+		Times:      0,
+		MaxTimes:   int64(store.RetryPolicyOf(task).MaxTimes),
+		Timeout:    task.Timeout(),
+		LockTime:   store.LockTimeOf(task),
+		LockStatus: store.LockStatusOf(task),
+		SID:        task.GetSID(),
+		CID:        cid,
+		CreateTime: time.Now().Unix(),
+		UpdateTime: time.Now().Unix(),
+	})
+	return nil
+}
+
+// Update 使用cid和任务进行更新
+func (s *Store) Update(cid string, task task.Tasker) (bool, error) {
+	log.Info("task process update: ", task)
+	data, err := store.Encode(task)
+	if err != nil {
+		return false, err
+	}
+	errMsg := ""
+	if err := task.GetLastError(); err != nil {
+		errMsg = err.Error()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, v := range s.items {
+		if v.TID != task.GetID() {
+			continue
+		}
+		v.Task = data
+		v.Priority = store.PriorityOf(task)
+		v.Result = store.Readable(task.GetLastResult())
+		v.Error = store.Readable(errMsg)
+		v.ExecTime = task.GetLastExecTime()
+		v.LockTime = store.LockTimeOf(task)
+		if ls := store.LockStatusOf(task); ls != 0 {
+			v.LockStatus = ls
+		}
+		v.SID = task.GetSID()
+		v.CID = cid
+		v.UpdateTime = time.Now().Unix()
+		count++
+	}
+	return count == 1, nil
+}
+
+// Delete 根据cid和任务id进行删除
+func (s *Store) Delete(cid string, id string) (bool, error) {
+	log.Info("task process delete: ", id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	items := s.items[:0]
+	for _, v := range s.items {
+		if v.TID == id && v.CID == cid {
+			count++
+			continue
+		}
+		items = append(items, v)
+	}
+	s.items = items
+	return count == 1, nil
+}
+
+// Mark 标记一个任务可被窃取
+func (s *Store) Mark(cid string, task task.Tasker) (bool, error) {
+	log.Info("task process mark: ", cid)
+
+	return s.Update(store.StealTag, task)
+}
+
+// Steal 窃取size个任务
+func (s *Store) Steal(cid string, size int) (int64, error) {
+	log.Info("task process steal: ", cid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := make([]*store.TaskItem, 0, size)
+	for _, v := range s.items {
+		if v.CID == store.StealTag {
+			m = append(m, v)
+		}
+	}
+	sortByCreateTime(m)
+	if len(m) > size {
+		m = m[:size]
+	}
+	for _, v := range m {
+		v.CID = cid
+	}
+	return int64(len(m)), nil
+}
+
+// Bury 将任务标记为死信, 死信任务不会再被拉取
+func (s *Store) Bury(cid string, task task.Tasker, reason string) (bool, error) {
+	log.Info("task process bury: ", task, reason)
+	data, err := store.Encode(task)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, v := range s.items {
+		if v.TID != task.GetID() {
+			continue
+		}
+		v.Task = data
+		v.Result = store.Readable(task.GetLastResult())
+		v.Error = store.Readable(reason)
+		v.ExecTime = task.GetLastExecTime()
+		v.LockStatus = store.LockStatusDead
+		v.CID = cid
+		v.UpdateTime = time.Now().Unix()
+		count++
+	}
+	return count == 1, nil
+}
+
+// Dead 按更新时间倒序分页获取业务的死信任务
+func (s *Store) Dead(appId string, offset, size int) ([]store.TaskItem, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make([]*store.TaskItem, 0)
+	for _, v := range s.items {
+		if isDead(v, appId) {
+			m = append(m, v)
+		}
+	}
+	sort.SliceStable(m, func(i, j int) bool {
+		return m[i].UpdateTime > m[j].UpdateTime
+	})
+	data := make([]store.TaskItem, 0, size)
+	for i := offset; i < len(m) && i < offset+size; i++ {
+		data = append(data, *m[i])
+	}
+	return data, int64(len(m)), nil
+}
+
+// Revive 重置业务死信任务的执行次数并标记为可窃取, 由消费者窃取后重新执行
+func (s *Store) Revive(appId string, tids []string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	for _, v := range s.items {
+		if !isDead(v, appId) || !contains(tids, v.TID) {
+			continue
+		}
+		item, err := store.Decode(v.Task)
+		if err != nil {
+			log.Error("task revive err, task: ", v.TID, " decode err: ", err)
+			continue
+		}
+		store.ResetTimes(item)
+		store.UnsetProcessing(item)
+		data, err := store.Encode(item)
+		if err != nil {
+			return count, err
+		}
+		v.Task = data
+		v.Times = 0
+		v.LockStatus = 0
+		v.LockTime = time.Now().Unix()
+		v.CID = store.StealTag
+		v.Error = ""
+		v.UpdateTime = time.Now().Unix()
+		count++
+	}
+	return count, nil
+}
+
+// Discard 删除业务的死信任务
+func (s *Store) Discard(appId string, tids []string) (int64, error) {
+	log.Info("task process discard: ", appId, tids)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	items := s.items[:0]
+	for _, v := range s.items {
+		if isDead(v, appId) && contains(tids, v.TID) {
+			count++
+			continue
+		}
+		items = append(items, v)
+	}
+	s.items = items
+	return count, nil
+}
+
+// Remove 根据任务ID删除任务处理区中的任务, 不限消费者
+func (s *Store) Remove(tid string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	items := s.items[:0]
+	for _, v := range s.items {
+		if v.TID == tid {
+			count++
+			continue
+		}
+		items = append(items, v)
+	}
+	s.items = items
+	return count > 0, nil
+}
+
+// Claim 时间轮中的任务开始执行前改为锁定状态, 任务已被修改、删除或被其他消费者取出时返回false
+func (s *Store) Claim(cid string, tid string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.items {
+		if v.TID == tid && v.CID == cid && v.LockStatus == store.LockStatusHeld {
+			v.LockStatus = 1
+			v.UpdateTime = time.Now().Unix()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Find 根据任务ID查询任务处理区中的任务
+func (s *Store) Find(tid string) (*store.TaskItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.items {
+		if v.TID == tid {
+			item := *v
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+// History 根据任务ID查询任务的全部执行日志
+func (s *Store) History(tid string) ([]store.TaskLog, error) {
+	return s.Logs(tid), nil
+}
+
+// Log 插入一条任务日志到日志区
+func (s *Store) Log(cid string, task task.Tasker) error {
+	log.Info("task log log: ", task)
+	data, err := store.Encode(task)
+	if err != nil {
+		return err
+	}
+	errMsg := ""
+	status := 1
+	if err := task.GetLastError(); err != nil {
+		errMsg = err.Error()
+		status = 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoID++
+	s.logs = append(s.logs, &store.TaskLog{TaskItem: store.TaskItem{
+		ID:         s.autoID,
+		TID:        task.GetID(),
+		AppID:      task.GetAppID(),
+		Priority:   store.PriorityOf(task),
+		UniqueKey:  store.UniqueKeyOf(task),
+		Task:       data,
+		Content:    store.Readable(task.GetContent()),
+		Result:     store.Readable(task.GetLastResult()),
+		Error:      store.Readable(errMsg),
+		ExecTime:   task.GetLastExecTime(),
+		Times:      task.GetTimes(),
+		LockTime:   task.GetNextTime(),
+		SID:        task.GetSID(),
+		CID:        cid,
+		CreateTime: time.Now().Unix(),
+		UpdateTime: time.Now().Unix(),
+	}, Status: status})
+	return nil
+}
+
+// Logs 返回一个任务的全部日志
+func (s *Store) Logs(tid string) []store.TaskLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	logs := make([]store.TaskLog, 0)
+	for _, v := range s.logs {
+		if v.TID == tid {
+			logs = append(logs, *v)
+		}
+	}
+	return logs
+}
+
+// Generate 生成一个token
+func (s *Store) Generate(tid string, lifetime time.Duration) (string, error) {
+	value := randstr.New(32)
+	s.mu.Lock()
+	s.tokens[tid] = token{value: value, expireAt: time.Now().Add(lifetime)}
+	s.mu.Unlock()
+	return value, nil
+}
+
+// Check 校验并删除一个token
+func (s *Store) Check(tid, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[tid]
+	if !ok {
+		return false, nil
+	}
+	delete(s.tokens, tid)
+	if time.Now().After(t.expireAt) {
+		return false, nil
+	}
+	return t.value == value, nil
+}
+
+// Reserve 在lifetime内将业务的幂等键绑定到任务ID, 已绑定其他任务时返回原任务ID和false
+func (s *Store) Reserve(appId, key, tid string, lifetime time.Duration) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := appId + ":" + key
+	if t, ok := s.idem[k]; ok && time.Now().Before(t.expireAt) {
+		return t.value, t.value == tid, nil
+	}
+	s.idem[k] = token{value: tid, expireAt: time.Now().Add(lifetime)}
+	return tid, true, nil
+}
+
+// Forget 解除幂等键与任务ID的绑定
+func (s *Store) Forget(appId, key, tid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := appId + ":" + key
+	if t, ok := s.idem[k]; ok && t.value == tid {
+		delete(s.idem, k)
+	}
+	return nil
+}
+
+// Lock 在lifetime内将业务唯一键绑定到任务ID, 已绑定其他任务时返回该任务ID和false
+func (s *Store) Lock(appId, key, tid string, lifetime time.Duration) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := appId + ":" + key
+	if t, ok := s.unique[k]; ok && time.Now().Before(t.expireAt) {
+		return t.value, t.value == tid, nil
+	}
+	s.unique[k] = token{value: tid, expireAt: time.Now().Add(lifetime)}
+	return tid, true, nil
+}
+
+// Relock 唯一键仍绑定old(或已过期)时改为绑定tid
+func (s *Store) Relock(appId, key, old, tid string, lifetime time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := appId + ":" + key
+	if t, ok := s.unique[k]; ok && time.Now().Before(t.expireAt) && t.value != old {
+		return false, nil
+	}
+	s.unique[k] = token{value: tid, expireAt: time.Now().Add(lifetime)}
+	return true, nil
+}
+
+// Unlock 唯一键仍绑定tid时解除绑定
+func (s *Store) Unlock(appId, key, tid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := appId + ":" + key
+	if t, ok := s.unique[k]; ok && t.value == tid {
+		delete(s.unique, k)
+	}
+	return nil
+}
+
+// Unique 查询业务唯一键对应的最新一个非死信任务
+func (s *Store) Unique(appId, key string) (*store.TaskItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.items) - 1; i >= 0; i-- {
+		v := s.items[i]
+		if v.AppID == appId && v.UniqueKey == key && v.LockStatus != store.LockStatusDead {
+			item := *v
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+// AddSchedule 新增一个周期任务计划
+func (s *Store) AddSchedule(sc *store.TaskSchedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoID++
+	v := *sc
+	v.ID = s.autoID
+	s.schedules = append(s.schedules, &v)
+	return nil
+}
+
+// GetSchedule 根据计划ID查询计划
+func (s *Store) GetSchedule(id string) (*store.TaskSchedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.schedules {
+		if v.ScheduleID == id {
+			sc := *v
+			return &sc, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListSchedules 分页获取业务的计划, 同时返回计划总数
+func (s *Store) ListSchedules(appId string, offset, size int) ([]store.TaskSchedule, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make([]store.TaskSchedule, 0)
+	for _, v := range s.schedules {
+		if v.AppID == appId {
+			m = append(m, *v)
+		}
+	}
+	total := int64(len(m))
+	if offset > len(m) {
+		offset = len(m)
+	}
+	m = m[offset:]
+	if size < len(m) {
+		m = m[:size]
+	}
+	return m, total, nil
+}
+
+// DueSchedules 获取until之前到期且未暂停的最多size个计划
+func (s *Store) DueSchedules(until int64, size int) ([]store.TaskSchedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make([]store.TaskSchedule, 0)
+	for _, v := range s.schedules {
+		if v.Paused == 0 && v.NextTime > 0 && v.NextTime <= until {
+			m = append(m, *v)
+		}
+	}
+	sort.SliceStable(m, func(i, j int) bool {
+		return m[i].NextTime < m[j].NextTime
+	})
+	if size < len(m) {
+		m = m[:size]
+	}
+	return m, nil
+}
+
+// AdvanceSchedule 计划的下次执行时间仍为prev时改为next
+func (s *Store) AdvanceSchedule(id string, prev, next, last int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.schedules {
+		if v.ScheduleID == id && v.NextTime == prev && v.Paused == 0 {
+			v.NextTime = next
+			v.LastTime = last
+			v.UpdateTime = time.Now().Unix()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PauseSchedule 暂停计划; paused为false时恢复计划并从next开始执行
+func (s *Store) PauseSchedule(id string, paused bool, next int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.schedules {
+		if v.ScheduleID != id {
+			continue
+		}
+		v.Paused = 0
+		if paused {
+			v.Paused = 1
+		} else {
+			v.NextTime = next
+		}
+		v.UpdateTime = time.Now().Unix()
+		return true, nil
+	}
+	return false, nil
+}
+
+// RemoveSchedule 删除计划
+func (s *Store) RemoveSchedule(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.schedules {
+		if v.ScheduleID == id {
+			s.schedules = append(s.schedules[:i], s.schedules[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AddWorkflow 新增工作流及其全部节点
+func (s *Store) AddWorkflow(wf *store.TaskWorkflow, nodes []store.TaskWorkflowNode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoID++
+	v := *wf
+	v.ID = s.autoID
+	s.workflows = append(s.workflows, &v)
+	for i := range nodes {
+		s.autoID++
+		n := nodes[i]
+		n.ID = s.autoID
+		s.nodes = append(s.nodes, &n)
+	}
+	return nil
+}
+
+// GetWorkflow 查询工作流及其全部节点
+func (s *Store) GetWorkflow(id string) (*store.TaskWorkflow, []store.TaskWorkflowNode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.workflows {
+		if v.WorkflowID != id {
+			continue
+		}
+		wf := *v
+		nodes := make([]store.TaskWorkflowNode, 0)
+		for _, n := range s.nodes {
+			if n.WorkflowID == id {
+				nodes = append(nodes, *n)
+			}
+		}
+		return &wf, nodes, nil
+	}
+	return nil, nil, nil
+}
+
+// NodeOf 根据任务ID查询工作流节点
+func (s *Store) NodeOf(tid string) (*store.TaskWorkflowNode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.nodes {
+		if v.TID == tid {
+			n := *v
+			return &n, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetNode 节点状态仍为from时改为to, tid不为空时同时记录节点的任务ID
+func (s *Store) SetNode(id int, from, to int, tid string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.nodes {
+		if v.ID != id {
+			continue
+		}
+		if v.Status != from {
+			return false, nil
+		}
+		v.Status = to
+		if tid != "" {
+			v.TID = tid
+		}
+		v.UpdateTime = time.Now().Unix()
+		return true, nil
+	}
+	return false, nil
+}
+
+// FinishWorkflow 运行中的工作流结束为status
+func (s *Store) FinishWorkflow(id string, status int, reason string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.workflows {
+		if v.WorkflowID == id && v.Status == store.WorkflowRunning {
+			v.Status = status
+			v.Error = store.Readable(reason)
+			v.UpdateTime = time.Now().Unix()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// StalledWorkflows 查询before之前创建、没有已推送节点的最多size个运行中工作流ID
+func (s *Store) StalledWorkflows(before int64, size int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pushed := make(map[string]bool)
+	for _, n := range s.nodes {
+		if n.Status == store.NodePushed {
+			pushed[n.WorkflowID] = true
+		}
+	}
+	ids := make([]string, 0)
+	for _, v := range s.workflows {
+		if len(ids) >= size {
+			break
+		}
+		if v.Status == store.WorkflowRunning && v.CreateTime <= before && !pushed[v.WorkflowID] {
+			ids = append(ids, v.WorkflowID)
+		}
+	}
+	return ids, nil
+}
+
+// Elect 竞选或续期name的执行者, 任期为lifetime
+func (s *Store) Elect(name, id string, lifetime time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.leaders[name]; ok && t.value != id && time.Now().Before(t.expireAt) {
+		return false, nil
+	}
+	s.leaders[name] = token{value: id, expireAt: time.Now().Add(lifetime)}
+	return true, nil
+}
+
+// enqueue 将任务插入到同优先级任务的尾部
+func (s *Store) enqueue(q queued) {
+	i := sort.Search(len(s.queue), func(i int) bool {
+		return s.queue[i].priority < q.priority
+	})
+	s.queue = append(s.queue, queued{})
+	copy(s.queue[i+1:], s.queue[i:])
+	s.queue[i] = q
+}
+
+// sortByPriority 按优先级降序, 锁定时间、自增ID升序排列
+func sortByPriority(m []*store.TaskItem) {
+	sort.SliceStable(m, func(i, j int) bool {
+		if m[i].Priority != m[j].Priority {
+			return m[i].Priority > m[j].Priority
+		}
+		if m[i].LockTime == m[j].LockTime {
+			return m[i].ID < m[j].ID
+		}
+		return m[i].LockTime < m[j].LockTime
+	})
+}
+
+// sortByCreateTime 按创建时间、自增ID升序排列
+func sortByCreateTime(m []*store.TaskItem) {
+	sort.SliceStable(m, func(i, j int) bool {
+		if m[i].CreateTime == m[j].CreateTime {
+			return m[i].ID < m[j].ID
+		}
+		return m[i].CreateTime < m[j].CreateTime
+	})
+}
+
+// patch 修改任务并重新序列化
+func patch(item task.Tasker, p task.Patch) ([]byte, error) {
+	if err := store.PatchTask(item, p); err != nil {
+		return nil, err
+	}
+	log.Info("task patch: ", item)
+	return store.Encode(item)
+}
+
+// isDead 判断是否为业务的死信任务
+func isDead(v *store.TaskItem, appId string) bool {
+	return v.AppID == appId && v.LockStatus == store.LockStatusDead
+}
+
+// contains 判断tid是否在tids中, tids为空时视为全部
+func contains(tids []string, tid string) bool {
+	if len(tids) == 0 {
+		return true
+	}
+	for _, v := range tids {
+		if v == tid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+)
+
+func newTask(id string, priority int) *task.HttpTask {
+	return &task.HttpTask{ID: id, AppID: "100", URL: "http://example.com", Priority: priority, ExecTimeout: 60}
+}
+
+func TestQueue(t *testing.T) {
+	s := NewStore()
+	for _, v := range []*task.HttpTask{newTask("t1", 0), newTask("t2", 5), newTask("t3", 0), newTask("t4", 5)} {
+		if ok, err := s.RPush(v); !ok || err != nil {
+			t.Fatalf("RPush(%s) = %v, %v", v.ID, ok, err)
+		}
+	}
+	//高优先级先出队, 同优先级先进先出
+	for _, want := range []string{"t2", "t4", "t1", "t3"} {
+		item, err := s.LPop()
+		if err != nil || item == nil || item.GetID() != want {
+			t.Fatalf("LPop() = %v, %v, want %s", item, err, want)
+		}
+		if err := s.Confirm(item.GetID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if item, err := s.LPop(); item != nil || err != nil {
+		t.Errorf("LPop() on empty queue = %v, %v", item, err)
+	}
+}
+
+func TestDelayAndPromote(t *testing.T) {
+	s := NewStore()
+	now := time.Now().Unix()
+	_, _ = s.Delay(newTask("t1", 0), now+60)
+	_, _ = s.Delay(newTask("t2", 0), now-1)
+	_, _ = s.Delay(newTask("t3", 0), now)
+
+	if item, at, _ := s.Lookup("t1"); item == nil || at != now+60 {
+		t.Errorf("Lookup(t1) = %v, %d", item, at)
+	}
+	if n, err := s.Promote(now, 10); err != nil || n != 2 {
+		t.Fatalf("Promote() = %d, %v, want 2", n, err)
+	}
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", s.Len())
+	}
+	if item, at, _ := s.Lookup("t3"); item == nil || at != 0 {
+		t.Errorf("Lookup(t3) after promote = %v, %d", item, at)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := NewStore()
+	_, _ = s.RPush(newTask("t1", 0))
+	_, _ = s.Delay(newTask("t2", 0), time.Now().Unix()+60)
+	if ok, _ := s.Acquire("t3", time.Minute); !ok {
+		t.Fatal("Acquire(t3) = false")
+	}
+	cases := []struct {
+		tid  string
+		want int
+	}{
+		{"t1", store.CancelRemoved},
+		{"t2", store.CancelRemoved},
+		{"t3", store.CancelRunning},
+		{"t4", store.CancelMarked},
+	}
+	for _, c := range cases {
+		if got, err := s.Cancel(c.tid); err != nil || got != c.want {
+			t.Errorf("Cancel(%s) = %d, %v, want %d", c.tid, got, err, c.want)
+		}
+	}
+	if s.Len() != 0 {
+		t.Errorf("Len() after cancel = %d, want 0", s.Len())
+	}
+	//已取消的任务不能开始执行, 执行结束后可以取消
+	if ok, _ := s.Acquire("t4", time.Minute); ok {
+		t.Error("Acquire(t4) after cancel = true")
+	}
+	_ = s.Release("t3")
+	if got, _ := s.Cancel("t3"); got != store.CancelMarked {
+		t.Errorf("Cancel(t3) after release = %d, want %d", got, store.CancelMarked)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	s := NewStore()
+	_ = s.Insert("c1", newTask("t1", 0))
+	_ = s.Insert("c1", newTask("t2", 5))
+	_ = s.Insert("c2", newTask("t3", 0))
+
+	now := time.Now().Unix()
+	data, err := s.Get("c1", 10)
+	if err != nil || len(data) != 2 || data[0].GetID() != "t2" {
+		t.Fatalf("Get() = %v, %v", data, err)
+	}
+	v, _ := s.Find("t2")
+	if v.LockStatus != 1 || v.Times != 1 || v.LockTime < now+60+store.MaxLockTime || v.LockTime > now+61+store.MaxLockTime {
+		t.Errorf("leased item = %+v", v)
+	}
+	//租用期内不会被再次拉取
+	if data, _ := s.Get("c1", 10); len(data) != 0 {
+		t.Errorf("Get() while leased = %v", data)
+	}
+
+	if ok, _ := s.Mark("c1", newTask("t1", 0)); !ok {
+		t.Fatal("Mark(t1) = false")
+	}
+	if n, _ := s.Steal("c2", 10); n != 1 {
+		t.Errorf("Steal() = %d, want 1", n)
+	}
+	if v, _ := s.Find("t1"); v.CID != "c2" {
+		t.Errorf("stolen item cid = %s, want c2", v.CID)
+	}
+	if ok, _ := s.Delete("c1", "t2"); !ok {
+		t.Error("Delete(t2) = false")
+	}
+	if ok, _ := s.Remove("t3"); !ok {
+		t.Error("Remove(t3) = false")
+	}
+	if v, _ := s.Find("t3"); v != nil {
+		t.Errorf("Find(t3) after remove = %+v", v)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	s := NewStore()
+	_ = s.Insert("c1", newTask("t1", 0))
+	_ = s.Insert("c1", newTask("t2", 0))
+	if ok, _ := s.Bury("c1", newTask("t1", 0), "exceeded max retry times"); !ok {
+		t.Fatal("Bury(t1) = false")
+	}
+	data, total, err := s.Dead("100", 0, 10)
+	if err != nil || total != 1 || data[0].TID != "t1" || data[0].Error != "exceeded max retry times" {
+		t.Fatalf("Dead() = %+v, %d, %v", data, total, err)
+	}
+	if data, _ := s.Get("c1", 10); len(data) != 1 || data[0].GetID() != "t2" {
+		t.Errorf("Get() with dead item = %v", data)
+	}
+	if n, _ := s.Discard("100", []string{"t2"}); n != 0 {
+		t.Errorf("Discard(t2) = %d, want 0", n)
+	}
+
+	if n, err := s.Revive("100", nil); err != nil || n != 1 {
+		t.Fatalf("Revive() = %d, %v, want 1", n, err)
+	}
+	v, _ := s.Find("t1")
+	if v.LockStatus != 0 || v.Times != 0 || v.CID != store.StealTag {
+		t.Errorf("revived item = %+v", v)
+	}
+	if _, total, _ := s.Dead("100", 0, 10); total != 0 {
+		t.Errorf("Dead() after revive total = %d, want 0", total)
+	}
+}
+
+func TestLog(t *testing.T) {
+	s := NewStore()
+	_ = s.Log("c1", newTask("t1", 0))
+	_ = s.Log("c1", newTask("t1", 0))
+	_ = s.Log("c1", newTask("t2", 0))
+	if logs, _ := s.History("t1"); len(logs) != 2 || logs[0].Status != 1 {
+		t.Errorf("History(t1) = %+v", logs)
+	}
+}
+
+func TestToken(t *testing.T) {
+	s := NewStore()
+	value, _ := s.Generate("t1", time.Minute)
+	if ok, _ := s.Check("t1", "wrong"); ok {
+		t.Error("Check() with wrong token = true")
+	}
+	//校验后token失效
+	if ok, _ := s.Check("t1", value); ok {
+		t.Error("Check() after failed check = true")
+	}
+	value, _ = s.Generate("t1", time.Minute)
+	if ok, _ := s.Check("t1", value); !ok {
+		t.Error("Check() = false")
+	}
+}
+
+func TestReserve(t *testing.T) {
+	s := NewStore()
+	if tid, ok, _ := s.Reserve("100", "k1", "t1", time.Minute); !ok || tid != "t1" {
+		t.Fatalf("Reserve(t1) = %s, %v", tid, ok)
+	}
+	if tid, ok, _ := s.Reserve("100", "k1", "t2", time.Minute); ok || tid != "t1" {
+		t.Errorf("Reserve(t2) = %s, %v, want t1, false", tid, ok)
+	}
+	if _, ok, _ := s.Reserve("200", "k1", "t2", time.Minute); !ok {
+		t.Error("Reserve() for other app = false")
+	}
+	_ = s.Forget("100", "k1", "t2")
+	if _, ok, _ := s.Reserve("100", "k1", "t2", time.Minute); ok {
+		t.Error("Reserve(t2) after forgetting other task = true")
+	}
+	_ = s.Forget("100", "k1", "t1")
+	if _, ok, _ := s.Reserve("100", "k1", "t2", time.Minute); !ok {
+		t.Error("Reserve(t2) after forget = false")
+	}
+}
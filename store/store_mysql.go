@@ -1,8 +1,11 @@
 package store
 
 import (
+	"database/sql"
+	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/meixiu/utask/app"
 	"github.com/meixiu/utask/log"
 	"github.com/meixiu/utask/task"
@@ -20,16 +23,21 @@ var (
 	StealTag = "NoID"
 )
 
-// NewMysqlStore 返回一个新MysqlStore对象
-var (
-	// DefaultMysqlStore redis store
-	DefaultMysqlStore = NewMysqlStore()
+const (
+	// LockStatusHeld 消费者调度中等待执行的任务, 开始执行前改为锁定状态, 等待期间可以被修改
+	LockStatusHeld = 4
+	// LockStatusDead 死信状态, 达到最大执行次数或执行时校验失败的任务
+	LockStatusDead = 3
 )
 
-func init() {
-	MaxLockTime = app.Config.Db.MaxLockTime
-	MaxRetryTimes = app.Config.Db.MaxRetryTimes
-}
+var (
+	// DefaultDbStore 根据db.driver配置选择的db store, 由Init创建
+	DefaultDbStore DbStorer
+	// DefaultMysqlStore mysql store, 仅在db.driver为mysql时由Init创建, 与DefaultDbStore为同一对象
+	//
+	// Deprecated: 使用DefaultDbStore
+	DefaultMysqlStore *MysqlStore
+)
 
 // NewMysqlStore 返回一个新MysqlStore对象
 func NewMysqlStore() *MysqlStore {
@@ -43,7 +51,8 @@ func NewMysqlStore() *MysqlStore {
 	db.SetConnMaxLifetime(20 * time.Minute) //默认30分钟的连接有效期
 	db.ShowSQL(false)
 
-	_ = db.Sync2(&TaskItem{}, &TaskLog{})
+	_ = db.Sync2(&TaskItem{}, &TaskLog{}, &TaskSchedule{}, &TaskWorkflow{}, &TaskWorkflowNode{})
+	buryExhausted(db)
 	return &MysqlStore{db}
 }
 
@@ -54,17 +63,16 @@ type MysqlStore struct {
 
 func (s *MysqlStore) Get(cid string, size int) (data []task.Tasker, err error) {
 	log.Info("task process get: ", cid, size)
-	m := make([]TaskItem, 0, size)
 
 	lockTime := time.Now().Unix()
-	nextLockTime := lockTime + MaxLockTime
+	lockID := uuid.New().String()
 
-	// 悲观获取
+	// 悲观获取, 按任务超时时间加MaxLockTime租用, 留出排队等待和写回结果的余量, 旧版本未记录超时时间的任务按MaxLockTime租用, 本次租用的任务用lock_id标记
 	rst, err := s.db.Exec(`UPDATE task_item
-SET lock_status = 1, lock_time = ?, times = times + 1, cid = ?
-WHERE cid = ? AND times < ? AND lock_time < ?
-ORDER BY create_time ASC
-LIMIT ?`, nextLockTime, cid, cid, MaxRetryTimes, lockTime, size)
+SET lock_status = 1, lock_id = ?, lock_time = ? + CASE WHEN timeout > 0 THEN timeout + ? ELSE ? END, times = times + 1, cid = ?
+WHERE cid = ? AND times < CASE WHEN max_times > 0 THEN max_times ELSE ? END AND lock_time < ? AND lock_status <> ?
+ORDER BY priority DESC, lock_time ASC
+LIMIT ?`, lockID, lockTime, MaxLockTime, MaxLockTime, cid, cid, MaxRetryTimes, lockTime, LockStatusDead, size)
 	if err != nil {
 		return nil, err
 	}
@@ -75,10 +83,16 @@ LIMIT ?`, nextLockTime, cid, cid, MaxRetryTimes, lockTime, size)
 	if rows == 0 {
 		return nil, err
 	}
+	return s.fetch(cid, lockID, size)
+}
+
+// fetch 查询已被cid以lockID悲观锁定的任务
+func (s *MysqlStore) fetch(cid string, lockID string, size int) (data []task.Tasker, err error) {
+	m := make([]TaskItem, 0, size)
 	err = s.db.SQL(`SELECT * FROM task_item 
-WHERE lock_status = 1 AND lock_time = ? AND cid = ?
-ORDER BY create_time ASC
-LIMIT ?`, nextLockTime, cid, size).Find(&m)
+WHERE lock_status = 1 AND lock_id = ? AND cid = ?
+ORDER BY priority DESC, create_time ASC
+LIMIT ?`, lockID, cid, size).Find(&m)
 	if err != nil {
 		return nil, err
 	}
@@ -98,21 +112,19 @@ func (s *MysqlStore) Insert(cid string, task task.Tasker) error {
 	if err != nil {
 		return err
 	}
-	lock := 0
-	lockTime := task.GetNextTime()
-	if task.IsProcessing() {
-		lock = 1
-		lockTime = time.Now().Unix() + task.Timeout()*2
-	}
 	_, err = s.db.Insert(&TaskItem{
 		TID:        task.GetID(),
 		AppID:      task.GetAppID(),
+		Priority:   PriorityOf(task),
+		UniqueKey:  UniqueKeyOf(task),
 		Task:       data,
-		Content:    task.GetContent(),
+		Content:    Readable(task.GetContent()),
 		Result:     "",
 		Times:      0,
-		LockTime:   lockTime,
-		LockStatus: lock,
+		MaxTimes:   int64(RetryPolicyOf(task).MaxTimes),
+		Timeout:    task.Timeout(),
+		LockTime:   LockTimeOf(task),
+		LockStatus: LockStatusOf(task),
 		SID:        task.GetSID(),
 		CID:        cid,
 		CreateTime: time.Now().Unix(),
@@ -133,10 +145,12 @@ func (s *MysqlStore) Update(cid string, task task.Tasker) (bool, error) {
 	}
 	count, err := s.db.Update(&TaskItem{
 		Task:       data,
-		Result:     task.GetLastResult(),
-		Error:      errMsg,
+		Priority:   PriorityOf(task),
+		Result:     Readable(task.GetLastResult()),
+		Error:      Readable(errMsg),
 		ExecTime:   task.GetLastExecTime(),
-		LockTime:   task.GetNextTime(),
+		LockTime:   LockTimeOf(task),
+		LockStatus: LockStatusOf(task),
 		SID:        task.GetSID(),
 		CID:        cid,
 		UpdateTime: time.Now().Unix(),
@@ -184,10 +198,12 @@ func (s *MysqlStore) Log(cid string, task task.Tasker) error {
 	_, err = s.db.Insert(&TaskLog{TaskItem: TaskItem{
 		TID:        task.GetID(),
 		AppID:      task.GetAppID(),
+		Priority:   PriorityOf(task),
+		UniqueKey:  UniqueKeyOf(task),
 		Task:       data,
-		Content:    task.GetContent(),
-		Result:     task.GetLastResult(),
-		Error:      errMsg,
+		Content:    Readable(task.GetContent()),
+		Result:     Readable(task.GetLastResult()),
+		Error:      Readable(errMsg),
 		ExecTime:   task.GetLastExecTime(),
 		Times:      task.GetTimes(),
 		LockTime:   task.GetNextTime(),
@@ -200,18 +216,423 @@ func (s *MysqlStore) Log(cid string, task task.Tasker) error {
 	return err
 }
 
+// Bury 将任务标记为死信, 死信任务不会再被拉取
+func (s *MysqlStore) Bury(cid string, task task.Tasker, reason string) (bool, error) {
+	log.Info("task process bury: ", task, reason)
+	data, err := Encode(task)
+	if err != nil {
+		return false, err
+	}
+	count, err := s.db.Update(&TaskItem{
+		Task:       data,
+		Result:     Readable(task.GetLastResult()),
+		Error:      Readable(reason),
+		ExecTime:   task.GetLastExecTime(),
+		LockStatus: LockStatusDead,
+		CID:        cid,
+		UpdateTime: time.Now().Unix(),
+	}, &TaskItem{
+		TID: task.GetID(),
+	})
+	return count == 1, err
+}
+
+// Dead 按更新时间倒序分页获取业务的死信任务
+func (s *MysqlStore) Dead(appId string, offset, size int) ([]TaskItem, int64, error) {
+	total, err := s.dead(appId).Count(&TaskItem{})
+	if err != nil {
+		return nil, 0, err
+	}
+	m := make([]TaskItem, 0, size)
+	err = s.dead(appId).Desc("update_time").Limit(size, offset).Find(&m)
+	if err != nil {
+		return nil, 0, err
+	}
+	return m, total, nil
+}
+
+// Revive 重置业务死信任务的执行次数并标记为可窃取, 由消费者窃取后重新执行
+func (s *MysqlStore) Revive(appId string, tids []string) (count int64, err error) {
+	lastID := 0
+	for {
+		m := make([]TaskItem, 0, BatchSize)
+		sess := s.dead(appId).And("id > ?", lastID)
+		if len(tids) > 0 {
+			sess = sess.In("tid", tids)
+		}
+		if err = sess.Asc("id").Limit(BatchSize).Find(&m); err != nil {
+			return count, err
+		}
+		for _, v := range m {
+			lastID = v.ID
+			item, err := Decode(v.Task)
+			if err != nil {
+				log.Error("task revive err, task: ", v.TID, " decode err: ", err)
+				continue
+			}
+			ResetTimes(item)
+			UnsetProcessing(item)
+			data, err := Encode(item)
+			if err != nil {
+				return count, err
+			}
+			now := time.Now().Unix()
+			//仅在任务未被修改时重置
+			rst, err := s.db.Exec(`UPDATE task_item
+SET task = ?, times = 0, lock_status = 0, lock_time = ?, cid = ?, error = '', update_time = ?
+WHERE id = ? AND lock_status = ? AND lock_time = ?`, data, now, StealTag, now, v.ID, v.LockStatus, v.LockTime)
+			if err != nil {
+				return count, err
+			}
+			n, _ := rst.RowsAffected()
+			count += n
+		}
+		if len(m) < BatchSize {
+			log.Info("task process revive: ", appId, count)
+			return count, nil
+		}
+	}
+}
+
+// Discard 删除业务的死信任务
+func (s *MysqlStore) Discard(appId string, tids []string) (int64, error) {
+	log.Info("task process discard: ", appId, tids)
+	sess := s.dead(appId)
+	if len(tids) > 0 {
+		sess = sess.In("tid", tids)
+	}
+	return sess.Delete(&TaskItem{})
+}
+
+// dead 业务死信任务的查询条件, 死信只由锁定状态标记
+func (s *MysqlStore) dead(appId string) *xorm.Session {
+	return s.db.Where("app_id = ? AND lock_status = ?", appId, LockStatusDead)
+}
+
+// buryExhausted 将旧版本中达到最大执行次数后停留在处理区且已解锁的任务标记为死信
+func buryExhausted(db *xorm.Engine) {
+	now := time.Now().Unix()
+	rst, err := db.Exec(`UPDATE task_item SET lock_status = ?, update_time = ?
+WHERE lock_status <> ? AND times >= CASE WHEN max_times > 0 THEN max_times ELSE ? END AND lock_time < ?`,
+		LockStatusDead, now, LockStatusDead, MaxRetryTimes, now)
+	if err != nil {
+		log.Error("task process bury exhausted err: ", err)
+		return
+	}
+	if n, _ := rst.RowsAffected(); n > 0 {
+		log.Info("task process bury exhausted: ", n)
+	}
+}
+
+// Remove 根据任务ID删除任务, 不限消费者
+func (s *MysqlStore) Remove(tid string) (bool, error) {
+	log.Info("task process remove: ", tid)
+	count, err := s.db.Delete(&TaskItem{TID: tid})
+	return count > 0, err
+}
+
+// Claim 时间轮中的任务开始执行前改为锁定状态, 任务已被修改、删除或被其他消费者取出时返回false
+func (s *MysqlStore) Claim(cid string, tid string) (bool, error) {
+	rst, err := s.db.Exec(`UPDATE task_item SET lock_status = 1, update_time = ? WHERE tid = ? AND cid = ? AND lock_status = ?`,
+		time.Now().Unix(), tid, cid, LockStatusHeld)
+	if err != nil {
+		return false, err
+	}
+	n, _ := rst.RowsAffected()
+	return n == 1, nil
+}
+
+// Patch 修改未被消费者锁定的任务, 与拉取任务、时间轮任务开始执行通过lock_status、lock_time比较更新互斥
+func (s *MysqlStore) Patch(tid string, p task.Patch) (int, error) {
+	for i := 0; i < patchRetryTimes; i++ {
+		v := &TaskItem{}
+		ok, err := s.db.Where("tid = ?", tid).Get(v)
+		if err != nil || !ok {
+			return PatchNotFound, err
+		}
+		now := time.Now().Unix()
+		if v.LockStatus == LockStatusDead {
+			return PatchDead, nil
+		}
+		if v.LockStatus == 1 && v.LockTime >= now {
+			return PatchLeased, nil
+		}
+		item, err := Decode(v.Task)
+		if err != nil {
+			return PatchNotFound, err
+		}
+		if err := PatchTask(item, p); err != nil {
+			return PatchNotFound, err
+		}
+		UnsetProcessing(item)
+		data, err := Encode(item)
+		if err != nil {
+			return PatchNotFound, err
+		}
+		rst, err := s.db.Exec(`UPDATE task_item
+SET task = ?, content = ?, lock_status = 0, lock_time = ?, update_time = ?
+WHERE id = ? AND lock_status = ? AND lock_time = ?`,
+			data, Readable(item.GetContent()), LockTimeOf(item), now, v.ID, v.LockStatus, v.LockTime)
+		if err != nil {
+			return PatchNotFound, err
+		}
+		if n, _ := rst.RowsAffected(); n == 1 {
+			log.Info("task process patch: ", item)
+			return PatchApplied, nil
+		}
+	}
+	return PatchNotFound, fmt.Errorf("task patch conflict: %s", tid)
+}
+
+// Unique 查询业务唯一键对应的最新一个非死信任务
+func (s *MysqlStore) Unique(appId, key string) (*TaskItem, error) {
+	v := &TaskItem{}
+	ok, err := s.db.Where("app_id = ? AND unique_key = ? AND lock_status <> ?", appId, key, LockStatusDead).
+		Desc("id").Get(v)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Find 根据任务ID查询任务处理区中的任务
+func (s *MysqlStore) Find(tid string) (*TaskItem, error) {
+	item := &TaskItem{}
+	ok, err := s.db.Where("tid = ?", tid).Get(item)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return item, nil
+}
+
+// History 根据任务ID查询任务的全部执行日志
+func (s *MysqlStore) History(tid string) ([]TaskLog, error) {
+	m := make([]TaskLog, 0)
+	err := s.db.Where("tid = ?", tid).Asc("id").Find(&m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Migrate 按ID分批将任务处理区的任务数据改写为当前编码格式, content、result、error列按crypto.columns配置改写
+// 仅在任务数据未被修改时写入, 可以在消费者运行时执行
+func (s *MysqlStore) Migrate() (count int64, err error) {
+	lastID := 0
+	for {
+		m := make([]TaskItem, 0, BatchSize)
+		err = s.db.Cols("id", "task", "content", "result", "error").Where("id > ?", lastID).Asc("id").Limit(BatchSize).Find(&m)
+		if err != nil {
+			return count, err
+		}
+		for _, v := range m {
+			lastID = v.ID
+			data, ok, err := Recode(v.Task)
+			if err != nil {
+				log.Error("task migrate err, id: ", v.ID, " recode err: ", err)
+				continue
+			}
+			content, result, errMsg := Readable(v.Content), Readable(v.Result), Readable(v.Error)
+			if !ok && content == v.Content && result == v.Result && errMsg == v.Error {
+				continue
+			}
+			rst, err := s.db.Exec(`UPDATE task_item SET task = ?, content = ?, result = ?, error = ? WHERE id = ? AND task = ?`,
+				data, content, result, errMsg, v.ID, v.Task)
+			if err != nil {
+				return count, err
+			}
+			n, _ := rst.RowsAffected()
+			count += n
+		}
+		if len(m) < BatchSize {
+			log.Info("task process migrate: ", count)
+			return count, nil
+		}
+	}
+}
+
+// AddSchedule 新增一个周期任务计划
+func (s *MysqlStore) AddSchedule(sc *TaskSchedule) error {
+	_, err := s.db.Insert(sc)
+	return err
+}
+
+// GetSchedule 根据计划ID查询计划
+func (s *MysqlStore) GetSchedule(id string) (*TaskSchedule, error) {
+	sc := &TaskSchedule{}
+	ok, err := s.db.Where("schedule_id = ?", id).Get(sc)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// ListSchedules 分页获取业务的计划, 同时返回计划总数
+func (s *MysqlStore) ListSchedules(appId string, offset, size int) ([]TaskSchedule, int64, error) {
+	total, err := s.db.Where("app_id = ?", appId).Count(&TaskSchedule{})
+	if err != nil {
+		return nil, 0, err
+	}
+	m := make([]TaskSchedule, 0, size)
+	err = s.db.Where("app_id = ?", appId).Asc("id").Limit(size, offset).Find(&m)
+	if err != nil {
+		return nil, 0, err
+	}
+	return m, total, nil
+}
+
+// DueSchedules 获取until之前到期且未暂停的最多size个计划
+func (s *MysqlStore) DueSchedules(until int64, size int) ([]TaskSchedule, error) {
+	m := make([]TaskSchedule, 0, size)
+	err := s.db.Where("paused = 0 AND next_time > 0 AND next_time <= ?", until).
+		Asc("next_time").Limit(size).Find(&m)
+	return m, err
+}
+
+// AdvanceSchedule 计划的下次执行时间仍为prev时改为next, 多个节点只有一个能推进成功
+func (s *MysqlStore) AdvanceSchedule(id string, prev, next, last int64) (bool, error) {
+	rst, err := s.db.Exec(`UPDATE task_schedule SET next_time = ?, last_time = ?, update_time = ?
+WHERE schedule_id = ? AND next_time = ? AND paused = 0`, next, last, time.Now().Unix(), id, prev)
+	if err != nil {
+		return false, err
+	}
+	n, _ := rst.RowsAffected()
+	return n == 1, nil
+}
+
+// PauseSchedule 暂停计划; paused为false时恢复计划并从next开始执行
+func (s *MysqlStore) PauseSchedule(id string, paused bool, next int64) (bool, error) {
+	var (
+		rst sql.Result
+		err error
+	)
+	if paused {
+		rst, err = s.db.Exec(`UPDATE task_schedule SET paused = 1, update_time = ? WHERE schedule_id = ?`,
+			time.Now().Unix(), id)
+	} else {
+		rst, err = s.db.Exec(`UPDATE task_schedule SET paused = 0, next_time = ?, update_time = ? WHERE schedule_id = ?`,
+			next, time.Now().Unix(), id)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, _ := rst.RowsAffected()
+	return n == 1, nil
+}
+
+// RemoveSchedule 删除计划
+func (s *MysqlStore) RemoveSchedule(id string) (bool, error) {
+	count, err := s.db.Delete(&TaskSchedule{ScheduleID: id})
+	return count == 1, err
+}
+
+// AddWorkflow 在一个事务中新增工作流及其全部节点
+func (s *MysqlStore) AddWorkflow(wf *TaskWorkflow, nodes []TaskWorkflowNode) error {
+	sess := s.db.NewSession()
+	defer sess.Close()
+	if err := sess.Begin(); err != nil {
+		return err
+	}
+	if _, err := sess.Insert(wf); err != nil {
+		_ = sess.Rollback()
+		return err
+	}
+	if _, err := sess.Insert(&nodes); err != nil {
+		_ = sess.Rollback()
+		return err
+	}
+	return sess.Commit()
+}
+
+// GetWorkflow 查询工作流及其全部节点
+func (s *MysqlStore) GetWorkflow(id string) (*TaskWorkflow, []TaskWorkflowNode, error) {
+	wf := &TaskWorkflow{}
+	ok, err := s.db.Where("workflow_id = ?", id).Get(wf)
+	if err != nil || !ok {
+		return nil, nil, err
+	}
+	nodes := make([]TaskWorkflowNode, 0)
+	if err := s.db.Where("workflow_id = ?", id).Asc("id").Find(&nodes); err != nil {
+		return nil, nil, err
+	}
+	return wf, nodes, nil
+}
+
+// NodeOf 根据任务ID查询工作流节点
+func (s *MysqlStore) NodeOf(tid string) (*TaskWorkflowNode, error) {
+	node := &TaskWorkflowNode{}
+	ok, err := s.db.Where("tid = ?", tid).Get(node)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return node, nil
+}
+
+// SetNode 节点状态仍为from时改为to, tid不为空时同时记录节点的任务ID
+func (s *MysqlStore) SetNode(id int, from, to int, tid string) (bool, error) {
+	var (
+		rst sql.Result
+		err error
+	)
+	now := time.Now().Unix()
+	if tid != "" {
+		rst, err = s.db.Exec(`UPDATE task_workflow_node SET status = ?, tid = ?, update_time = ? WHERE id = ? AND status = ?`,
+			to, tid, now, id, from)
+	} else {
+		rst, err = s.db.Exec(`UPDATE task_workflow_node SET status = ?, update_time = ? WHERE id = ? AND status = ?`,
+			to, now, id, from)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, _ := rst.RowsAffected()
+	return n == 1, nil
+}
+
+// FinishWorkflow 运行中的工作流结束为status
+func (s *MysqlStore) FinishWorkflow(id string, status int, reason string) (bool, error) {
+	rst, err := s.db.Exec(`UPDATE task_workflow SET status = ?, error = ?, update_time = ? WHERE workflow_id = ? AND status = ?`,
+		status, Readable(reason), time.Now().Unix(), id, WorkflowRunning)
+	if err != nil {
+		return false, err
+	}
+	n, _ := rst.RowsAffected()
+	return n == 1, nil
+}
+
+// StalledWorkflows 查询before之前创建、没有已推送节点的最多size个运行中工作流ID
+func (s *MysqlStore) StalledWorkflows(before int64, size int) ([]string, error) {
+	m := make([]TaskWorkflow, 0, size)
+	err := s.db.Where(`status = ? AND create_time <= ? AND NOT EXISTS
+(SELECT 1 FROM task_workflow_node n WHERE n.workflow_id = task_workflow.workflow_id AND n.status = ?)`,
+		WorkflowRunning, before, NodePushed).Asc("id").Limit(size).Find(&m)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(m))
+	for _, v := range m {
+		ids = append(ids, v.WorkflowID)
+	}
+	return ids, nil
+}
+
 type TaskItem struct {
 	ID         int    `xorm:"'id' not null pk autoincr comment('自增ID') INT(11)"`
 	TID        string `xorm:"'tid' not null comment('任务编号') index VARCHAR(36)"`
 	AppID      string `xorm:"'app_id' not null comment('业务方ID') index VARCHAR(50)"`
+	Priority   int    `xorm:"not null default 0 comment('优先级, 越大越优先') index TINYINT(4)"`
+	UniqueKey  string `xorm:"'unique_key' not null default '' comment('业务唯一键') index VARCHAR(191)"`
 	Task       []byte `xorm:"not null comment('任务') BLOB"`
 	Content    string `xorm:"comment('任务内容') TEXT"`
 	Result     string `xorm:"comment('任务结果') TEXT"`
 	Error      string `xorm:"comment('错误信息') TEXT"`
 	ExecTime   int64  `xorm:"not null comment('执行花费时间(毫秒)') INT(11)"`
 	Times      int64  `xorm:"not null comment('执行次数') INT(11)"`
-	LockTime   int64  `xorm:"comment('锁定时间戳') INT(11)"`
-	LockStatus int    `xorm:"comment('锁定状态; 0:新建; 1:处理; 2: 完成;') TINYINT(4)"`
+	MaxTimes   int64  `xorm:"not null default 0 comment('最大执行次数, 0为使用全局配置') INT(11)"`
+	LockTime   int64  `xorm:"comment('锁定时间戳') index INT(11)"`
+	LockStatus int    `xorm:"comment('锁定状态; 0:新建; 1:处理中; 3:死信; 4:调度中;') TINYINT(4)"`
+	LockID     string `xorm:"'lock_id' not null default '' comment('本次租用标志') index VARCHAR(36)"`
+	Timeout    int64  `xorm:"not null default 0 comment('执行超时时间(秒), 0为使用全局配置') INT(11)"`
 	SID        string `xorm:"'sid' not null comment('生产者ID') VARCHAR(36)"`
 	CID        string `xorm:"'cid' not null comment('消费者ID') VARCHAR(36)"`
 	CreateTime int64  `xorm:"not null comment('创建时间戳') INT(11)"`
@@ -222,3 +643,48 @@ type TaskLog struct {
 	TaskItem `xorm:"extends"`
 	Status   int `xorm:"comment('任务结果状态(1:成功, 0:失败)') TINYINT(4)"`
 }
+
+// TaskSchedule 周期任务计划, 到期时由唯一的执行者按任务模板生成任务
+type TaskSchedule struct {
+	ID         int    `xorm:"'id' not null pk autoincr comment('自增ID') INT(11)"`
+	ScheduleID string `xorm:"'schedule_id' not null comment('计划编号') unique VARCHAR(36)"`
+	AppID      string `xorm:"'app_id' not null comment('业务方ID') index VARCHAR(50)"`
+	Name       string `xorm:"not null default '' comment('计划名称') VARCHAR(100)"`
+	Cron       string `xorm:"not null comment('cron表达式') VARCHAR(100)"`
+	Timezone   string `xorm:"not null default '' comment('时区') VARCHAR(50)"`
+	Type       string `xorm:"not null comment('任务类型') VARCHAR(20)"`
+	Template   []byte `xorm:"not null comment('任务模板') BLOB"`
+	Content    string `xorm:"comment('任务模板内容') TEXT"`
+	Missed     string `xorm:"not null comment('错过执行的处理; skip|once|catchup') VARCHAR(10)"`
+	Paused     int    `xorm:"not null default 0 comment('暂停状态; 0:运行; 1:暂停') TINYINT(4)"`
+	NextTime   int64  `xorm:"not null comment('下次执行时间戳') index INT(11)"`
+	LastTime   int64  `xorm:"not null default 0 comment('上次执行时间戳') INT(11)"`
+	CreateTime int64  `xorm:"not null comment('创建时间戳') INT(11)"`
+	UpdateTime int64  `xorm:"not null comment('更新时间戳') INT(11)"`
+}
+
+// TaskWorkflow 任务工作流, 节点任务在依赖的节点全部执行成功后推送
+type TaskWorkflow struct {
+	ID         int    `xorm:"'id' not null pk autoincr comment('自增ID') INT(11)"`
+	WorkflowID string `xorm:"'workflow_id' not null comment('工作流编号') unique VARCHAR(36)"`
+	AppID      string `xorm:"'app_id' not null comment('业务方ID') index VARCHAR(50)"`
+	Name       string `xorm:"not null default '' comment('工作流名称') VARCHAR(100)"`
+	Status     int    `xorm:"not null default 0 comment('状态; 0:运行; 1:成功; 2:失败') TINYINT(4)"`
+	Error      string `xorm:"comment('失败原因') TEXT"`
+	CreateTime int64  `xorm:"not null comment('创建时间戳') INT(11)"`
+	UpdateTime int64  `xorm:"not null comment('更新时间戳') INT(11)"`
+}
+
+// TaskWorkflowNode 工作流中的一个任务节点
+type TaskWorkflowNode struct {
+	ID         int    `xorm:"'id' not null pk autoincr comment('自增ID') INT(11)"`
+	WorkflowID string `xorm:"'workflow_id' not null comment('工作流编号') index VARCHAR(36)"`
+	Name       string `xorm:"not null comment('节点名称') VARCHAR(100)"`
+	Depends    string `xorm:"not null default '' comment('依赖的节点名称, 逗号分隔') VARCHAR(1000)"`
+	TID        string `xorm:"'tid' not null default '' comment('任务编号') index VARCHAR(36)"`
+	Task       []byte `xorm:"not null comment('任务模板') BLOB"`
+	Content    string `xorm:"comment('任务内容') TEXT"`
+	Status     int    `xorm:"not null default 0 comment('状态; 0:等待; 1:已推送; 2:成功; 3:失败; 4:跳过') TINYINT(4)"`
+	CreateTime int64  `xorm:"not null comment('创建时间戳') INT(11)"`
+	UpdateTime int64  `xorm:"not null comment('更新时间戳') INT(11)"`
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/meixiu/utask/app"
+	"github.com/meixiu/utask/log"
+	"github.com/meixiu/utask/task"
+
+	_ "github.com/lib/pq"
+	"xorm.io/xorm"
+)
+
+// NewPostgresStore 返回一个新PostgresStore对象
+func NewPostgresStore() *PostgresStore {
+	db, err := xorm.NewEngine(app.Config.Db.Driver, app.Config.Db.Source)
+	if err != nil {
+		log.Error("database err: ", err)
+		return nil
+	}
+	db.SetMaxOpenConns(50)
+	db.SetMaxIdleConns(30)
+	db.SetConnMaxLifetime(20 * time.Minute) //默认30分钟的连接有效期
+	db.ShowSQL(false)
+
+	_ = db.Sync2(&TaskItem{}, &TaskLog{}, &TaskSchedule{}, &TaskWorkflow{}, &TaskWorkflowNode{})
+	buryExhausted(db)
+	return &PostgresStore{MysqlStore{db}}
+}
+
+// PostgresStore 是一个使用postgres实现的logStore，processStore
+// 与MysqlStore共用表结构, 使用SELECT ... FOR UPDATE SKIP LOCKED原子租用任务
+type PostgresStore struct {
+	MysqlStore
+}
+
+func (s *PostgresStore) Get(cid string, size int) (data []task.Tasker, err error) {
+	log.Info("task process get: ", cid, size)
+	m := make([]TaskItem, 0, size)
+
+	lockTime := time.Now().Unix()
+
+	// 跳过其他事务已锁定的行, 与MysqlStore相同按任务超时时间加MaxLockTime租用, 租用和返回在同一语句中完成
+	err = s.db.SQL(`UPDATE task_item
+SET lock_status = 1, lock_time = ? + CASE WHEN timeout > 0 THEN timeout + ? ELSE ? END, times = times + 1, cid = ?
+WHERE id IN (SELECT id FROM task_item
+WHERE cid = ? AND times < CASE WHEN max_times > 0 THEN max_times ELSE ? END AND lock_time < ? AND lock_status <> ?
+ORDER BY priority DESC, lock_time ASC
+LIMIT ?
+FOR UPDATE SKIP LOCKED)
+RETURNING *`, lockTime, MaxLockTime, MaxLockTime, cid, cid, MaxRetryTimes, lockTime, LockStatusDead, size).Find(&m)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING不保证顺序
+	sort.SliceStable(m, func(i, j int) bool {
+		if m[i].Priority != m[j].Priority {
+			return m[i].Priority > m[j].Priority
+		}
+		return m[i].CreateTime < m[j].CreateTime
+	})
+	for _, k := range m {
+		item, err := Decode(k.Task)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, item)
+	}
+	return data, nil
+}
+
+func (s *PostgresStore) Steal(cid string, size int) (int64, error) {
+	log.Info("task process steal: ", cid)
+
+	rst, err := s.db.Exec(`UPDATE task_item SET cid = ? WHERE id IN (SELECT id FROM task_item WHERE cid = ? ORDER BY create_time ASC LIMIT ? FOR UPDATE SKIP LOCKED)`,
+		cid, StealTag, size)
+	if err != nil {
+		return 0, err
+	}
+	return rst.RowsAffected()
+}
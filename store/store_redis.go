@@ -2,6 +2,11 @@ package store
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/meixiu/utask/app"
@@ -12,37 +17,382 @@ import (
 	"github.com/go-redis/redis"
 )
 
-// RedisKey 是redisStore队列key
-const RedisKey = "UTask"
+const (
+	// RedisKey 是redisStore旧版本的全局队列key, 仍会被拉取
+	RedisKey = "UTask"
+	// RedisQueuesKey 是活跃业务队列集合key
+	RedisQueuesKey = "UTask:queues"
+	// RedisDataKey 是队列中任务数据的hash key
+	RedisDataKey = "UTask:data"
+	// RedisRouteKey 是任务所属业务队列的hash key
+	RedisRouteKey = "UTask:route"
+	// RedisLeasedKey 是已取出待确认任务数据的hash key
+	RedisLeasedKey = "UTask:leased"
+	// RedisDelayKey 是延时、重试任务按到期时间排序的zset key
+	RedisDelayKey = "UTask:delay"
+	// RedisConsumersKey 是消费者集合key
+	RedisConsumersKey = "UTask:consumers"
+	// redisQueuePrefix 是业务队列key前缀, 完整key为 前缀+优先级:业务ID[:任务类型]
+	redisQueuePrefix = "UTask:queue:"
+	// redisProcessingPrefix 是消费者处理中队列key前缀
+	redisProcessingPrefix = "UTask:processing:"
+	// redisAlivePrefix 是消费者心跳key前缀
+	redisAlivePrefix = "UTask:alive:"
+	// redisCancelPrefix 是已取消任务标记key前缀
+	redisCancelPrefix = "UTask:cancel:"
+	// redisRunPrefix 是执行中任务标记key前缀
+	redisRunPrefix = "UTask:run:"
+	// redisIdempotencyPrefix 是幂等键key前缀, 完整key为 前缀+业务ID:幂等键
+	redisIdempotencyPrefix = "UTask:idem:"
+	// redisUniquePrefix 是业务唯一键锁key前缀, 完整key为 前缀+业务ID:唯一键
+	redisUniquePrefix = "UTask:unique:"
+	// redisLeaderPrefix 是执行者选举key前缀
+	redisLeaderPrefix = "UTask:leader:"
+	// routeRetryTimes 读取任务路由后路由被并发修改时的重试次数
+	routeRetryTimes = 3
+)
 
-// RedisStore 是redis实现的taskStore
 var (
-	// DefaultRedisStore redis store
-	DefaultRedisStore = NewRedisStore()
+	// RedisAliveTime 消费者心跳有效期, 超过有效期未取任务的消费者视为失效
+	RedisAliveTime = 30 * time.Second
+	// RedisQueuesRefresh 活跃业务队列集合的刷新间隔
+	RedisQueuesRefresh = time.Second
+	// RedisCancelTime 取消标记的最短有效期, 未到期的任务按剩余延时加超时时间延长, 见CancelTimeOf
+	RedisCancelTime = 24 * time.Hour
+)
+
+// 脚本访问的key都通过KEYS传入: 任务路由中的业务队列由调用方先读取并传入, 脚本内校验路由未被修改, 已修改时返回-1由调用方重试
+var (
+	// popScript 按顺序从业务队列中原子的取出一个任务到处理中队列(等同LMOVE LEFT RIGHT, 兼容低版本redis)
+	// KEYS: 处理中队列, 任务数据, 待确认数据, 心跳, 消费者集合, 队列集合, 业务队列...
+	// ARGV: 消费者ID, 心跳有效期(秒)
+	// 返回: 队列成员, 任务数据, 取出任务的业务队列
+	popScript = redis.NewScript(`
+redis.call('SET', KEYS[4], 1, 'EX', ARGV[2])
+redis.call('SADD', KEYS[5], ARGV[1])
+for i = 7, #KEYS do
+	local m = redis.call('LPOP', KEYS[i])
+	if m then
+		redis.call('RPUSH', KEYS[1], m)
+		local d = redis.call('HGET', KEYS[2], m)
+		if not d then
+			-- 兼容队列中直接存储任务数据的旧格式
+			return {m, m, KEYS[i]}
+		end
+		redis.call('HDEL', KEYS[2], m)
+		redis.call('HSET', KEYS[3], m, d)
+		return {m, d, KEYS[i]}
+	end
+	-- 空队列移出活跃队列集合, 再次写入时加回
+	redis.call('SREM', KEYS[6], KEYS[i])
+end
+return false
+`)
+
+	// requeueScript 将处理中队列的一个任务放回所属业务队列尾部
+	// KEYS: 处理中队列, 任务数据, 待确认数据, 任务路由, 队列集合, 所属业务队列
+	// ARGV: 队列成员, 读取到的任务路由(没有路由时为空)
+	requeueScript = redis.NewScript(`
+if (redis.call('HGET', KEYS[4], ARGV[1]) or '') ~= ARGV[2] then
+	return -1
+end
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('RPUSH', KEYS[6], ARGV[1])
+redis.call('SADD', KEYS[5], KEYS[6])
+local d = redis.call('HGET', KEYS[3], ARGV[1])
+if d then
+	redis.call('HSET', KEYS[2], ARGV[1], d)
+	redis.call('HDEL', KEYS[3], ARGV[1])
+end
+return 1
+`)
+
+	// recoverScript 将处理中队列的全部任务按原顺序放回所属业务队列头部
+	// KEYS: 处理中队列, 任务数据, 待确认数据, 任务路由, 队列集合, 旧版本全局队列, 业务队列...
+	recoverScript = redis.NewScript(`
+local queues = {}
+for i = 6, #KEYS do
+	queues[KEYS[i]] = true
+end
+for _, m in ipairs(redis.call('LRANGE', KEYS[1], 0, -1)) do
+	if not queues[redis.call('HGET', KEYS[4], m) or KEYS[6]] then
+		return -1
+	end
+end
+local n = 0
+while true do
+	local m = redis.call('RPOP', KEYS[1])
+	if not m then
+		break
+	end
+	local q = redis.call('HGET', KEYS[4], m) or KEYS[6]
+	redis.call('LPUSH', q, m)
+	redis.call('SADD', KEYS[5], q)
+	local d = redis.call('HGET', KEYS[3], m)
+	if d then
+		redis.call('HSET', KEYS[2], m, d)
+		redis.call('HDEL', KEYS[3], m)
+	end
+	n = n + 1
+end
+return n
+`)
+
+	// promoteScript 将到期任务从调度区移回所属业务队列
+	// KEYS: 调度区, 任务路由, 队列集合, 旧版本全局队列, 业务队列...
+	// ARGV: 到期时间, 最大个数
+	promoteScript = redis.NewScript(`
+local queues = {}
+for i = 4, #KEYS do
+	queues[KEYS[i]] = true
+end
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	if not queues[redis.call('HGET', KEYS[2], id) or KEYS[4]] then
+		return -1
+	end
+end
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local q = redis.call('HGET', KEYS[2], id) or KEYS[4]
+	redis.call('RPUSH', q, id)
+	redis.call('SADD', KEYS[3], q)
+end
+return #ids
+`)
+
+	// recodeScript 任务数据未被修改时改写为新的编码
+	// KEYS: 任务数据
+	// ARGV: 任务ID, 原数据, 新数据
+	recodeScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+	return 1
+end
+return 0
+`)
+
+	// upgradeScript 将旧版本全局队列中的一个任务改写为新的编码并移到所属业务队列头部
+	// KEYS: 旧版本全局队列, 任务数据, 任务路由, 队列集合, 业务队列
+	// ARGV: 原数据, 任务ID, 新数据
+	upgradeScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], ARGV[2], ARGV[3])
+redis.call('HSET', KEYS[3], ARGV[2], KEYS[5])
+redis.call('SADD', KEYS[4], KEYS[5])
+redis.call('LPUSH', KEYS[5], ARGV[2])
+return 1
+`)
+
+	// cancelScript 任务未在执行时标记为已取消, 并从业务队列和调度区移除
+	// KEYS: 任务数据, 任务路由, 调度区, 待确认数据, 取消标记, 执行标记, 所属业务队列
+	// ARGV: 任务ID, 取消标记有效期(秒), 读取到的任务路由(没有路由时为空)
+	cancelScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[6]) == 1 then
+	return 0
+end
+if (redis.call('HGET', KEYS[2], ARGV[1]) or '') ~= ARGV[3] then
+	return -1
+end
+redis.call('SET', KEYS[5], 1, 'EX', ARGV[2])
+local found = redis.call('HEXISTS', KEYS[4], ARGV[1])
+if ARGV[3] ~= '' then
+	found = found + redis.call('LREM', KEYS[7], 0, ARGV[1])
+end
+found = found + redis.call('HDEL', KEYS[1], ARGV[1])
+found = found + redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if found > 0 then
+	return 1
+end
+return 2
+`)
+
+	// acquireScript 任务未被取消时设置执行标记
+	// KEYS: 取消标记, 执行标记
+	// ARGV: 执行标记有效期(秒)
+	acquireScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('SET', KEYS[2], 1, 'EX', ARGV[1])
+return 1
+`)
+
+	// reserveScript 幂等键不存在时绑定任务ID并设置有效期, 返回幂等键绑定的任务ID
+	// KEYS: 幂等键
+	// ARGV: 任务ID, 有效期(秒)
+	reserveScript = redis.NewScript(`
+local tid = redis.call('GET', KEYS[1])
+if tid then
+	return tid
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return ARGV[1]
+`)
+
+	// forgetScript 幂等键仍绑定该任务ID时删除
+	// KEYS: 幂等键
+	// ARGV: 任务ID
+	forgetScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+	// relockScript 唯一键仍绑定原任务ID时改为绑定新任务ID
+	// KEYS: 唯一键
+	// ARGV: 原任务ID, 新任务ID, 有效期(秒)
+	relockScript = redis.NewScript(`
+local tid = redis.call('GET', KEYS[1])
+if tid and tid ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'EX', ARGV[3])
+return 1
+`)
+
+	// electScript 没有执行者或执行者为自己时当选并设置任期
+	// KEYS: 选举key
+	// ARGV: 候选者ID, 任期(毫秒)
+	electScript = redis.NewScript(`
+local id = redis.call('GET', KEYS[1])
+if id and id ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+	// patchScript 任务未被取出且未被修改时写入修改后的任务, 在调度区中时同时修改到期时间
+	// KEYS: 任务数据, 待确认数据, 调度区
+	// ARGV: 任务ID, 原数据, 新数据, 新的到期时间
+	patchScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 1 then
+	return 2
+end
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+if redis.call('ZSCORE', KEYS[3], ARGV[1]) then
+	redis.call('ZADD', KEYS[3], ARGV[4], ARGV[1])
+end
+return 1
+`)
+
+	// patchLegacyScript 替换旧版本全局队列中未被取出的任务数据
+	// KEYS: 旧版本全局队列
+	// ARGV: 原数据, 新数据
+	patchLegacyScript = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[1], 0, -1)
+for i, v in ipairs(items) do
+	if v == ARGV[1] then
+		redis.call('LSET', KEYS[1], i - 1, ARGV[2])
+		return 1
+	end
+end
+return 0
+`)
+
+	// confirmScript 从处理中队列删除任务, 任务已被重新写入队列或调度区时保留任务路由
+	// KEYS: 处理中队列, 待确认数据, 任务路由, 任务数据
+	// ARGV: 队列成员, 任务ID
+	confirmScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[2])
+if redis.call('HEXISTS', KEYS[4], ARGV[2]) == 0 then
+	redis.call('HDEL', KEYS[3], ARGV[2])
+end
+return 1
+`)
+
+	// purgeScript 清空业务队列及队列中的任务数据, 同时移除调度区中属于该业务的任务
+	// KEYS: 任务数据, 任务路由, 队列集合, 调度区, 业务队列...
+	// ARGV: 调度区中属于该业务的任务ID, 读取到的任务路由...
+	purgeScript = redis.NewScript(`
+local n = 0
+for i = 5, #KEYS do
+	local ids = redis.call('LRANGE', KEYS[i], 0, -1)
+	for _, id in ipairs(ids) do
+		redis.call('HDEL', KEYS[1], id)
+		redis.call('HDEL', KEYS[2], id)
+	end
+	n = n + #ids
+	redis.call('DEL', KEYS[i])
+	redis.call('SREM', KEYS[3], KEYS[i])
+end
+for i = 1, #ARGV, 2 do
+	local id = ARGV[i]
+	if redis.call('HGET', KEYS[2], id) == ARGV[i + 1] and redis.call('ZREM', KEYS[4], id) == 1 then
+		redis.call('HDEL', KEYS[1], id)
+		redis.call('HDEL', KEYS[2], id)
+		n = n + 1
+	end
+end
+return n
+`)
+)
+
+var (
+	// DefaultRedisStore redis store, 由Init创建
+	DefaultRedisStore *RedisStore
 )
 
 // RedisStore 是redis实现的taskStore
+// 取出的任务先进入消费者自己的处理中队列, 确认后才删除, 失效消费者的任务由Recover放回队列
+// 任务按优先级和业务(可选按任务类型)进入各自的队列, 拉取时先取高优先级, 同优先级内按权重轮询各业务队列
 type RedisStore struct {
-	redis *redis.Client
+	redis   *redis.Client
+	id      string   // 消费者ID, 每次启动都不相同
+	pending sync.Map // 待确认任务 tid -> 处理中队列成员
+
+	mu        sync.Mutex
+	levels    []*pollLevel // 按优先级降序的轮询层
+	refreshAt time.Time    // 上次刷新活跃业务队列的时间
+}
+
+// pollLevel 同一优先级的业务队列轮询状态
+type pollLevel struct {
+	priority int
+	rounds   []string // 按权重展开的业务队列轮询顺序
+	cursor   int      // 当前轮询位置
 }
 
 func (s *RedisStore) LPop() (task task.Tasker, err error) {
-	t, err := s.redis.LPop(RedisKey).Result()
+	queues, err := s.pollQueues()
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{s.processingKey(s.id), RedisDataKey, RedisLeasedKey, s.aliveKey(s.id), RedisConsumersKey, RedisQueuesKey}
+	keys = append(keys, queues...)
+	res, err := popScript.Run(s.redis, keys, s.id, int(RedisAliveTime/time.Second)).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 3 {
+		return nil, fmt.Errorf("task pop unexpected result: %v", res)
+	}
+	member, _ := vals[0].(string)
+	t, _ := vals[1].(string)
+	queue, _ := vals[2].(string)
+	s.advance(queue)
 	task, err = Decode([]byte(t))
 	if err != nil {
-		_, errPush := s.redis.RPush(RedisKey, t).Result()
-		if errPush != nil {
+		if errPush := s.requeue(member); errPush != nil {
 			//这条记录需要重发
 			log.Error("task pop err, task : ", t, " data pop err: ", err, " push back err: ", errPush)
 		}
 		return nil, err
 	}
+	s.pending.Store(task.GetID(), member)
 	log.Info("task pop: ", task)
 	return task, nil
 }
@@ -52,7 +402,14 @@ func (s *RedisStore) RPush(task task.Tasker) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	_, err = s.redis.RPush(RedisKey, string(data)).Result()
+	queue := s.queueKey(task)
+	_, err = s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(RedisDataKey, task.GetID(), string(data))
+		pipe.HSet(RedisRouteKey, task.GetID(), queue)
+		pipe.SAdd(RedisQueuesKey, queue)
+		pipe.RPush(queue, task.GetID())
+		return nil
+	})
 	if err != nil {
 		return false, err
 	}
@@ -60,6 +417,450 @@ func (s *RedisStore) RPush(task task.Tasker) (bool, error) {
 	return true, nil
 }
 
+// RPushBatch 使用一次事务管道批量增加任务到业务队列尾部, 序列化失败的任务不写入
+func (s *RedisStore) RPushBatch(tasks []task.Tasker) ([]error, error) {
+	errs := make([]error, len(tasks))
+	data := make([][]byte, len(tasks))
+	for i, task := range tasks {
+		data[i], errs[i] = Encode(task)
+	}
+	_, err := s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		for i, task := range tasks {
+			if errs[i] != nil {
+				continue
+			}
+			queue := s.queueKey(task)
+			pipe.HSet(RedisDataKey, task.GetID(), string(data[i]))
+			pipe.HSet(RedisRouteKey, task.GetID(), queue)
+			pipe.SAdd(RedisQueuesKey, queue)
+			pipe.RPush(queue, task.GetID())
+		}
+		return nil
+	})
+	if err != nil {
+		return errs, err
+	}
+	for i, task := range tasks {
+		if errs[i] == nil {
+			log.Info("task push: ", task)
+		}
+	}
+	return errs, nil
+}
+
+// Confirm 二次确认, 从处理中队列删除任务; 任务已被Delay或RPush重新写入时保留任务路由
+func (s *RedisStore) Confirm(tid string) error {
+	member := tid
+	if v, ok := s.pending.Load(tid); ok {
+		member = v.(string)
+		s.pending.Delete(tid)
+	}
+	keys := []string{s.processingKey(s.id), RedisLeasedKey, RedisRouteKey, RedisDataKey}
+	return confirmScript.Run(s.redis, keys, member, tid).Err()
+}
+
+// Delay 将任务加入调度区, 在at时间到期
+func (s *RedisStore) Delay(task task.Tasker, at int64) (bool, error) {
+	data, err := Encode(task)
+	if err != nil {
+		return false, err
+	}
+	_, err = s.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(RedisDataKey, task.GetID(), string(data))
+		pipe.HSet(RedisRouteKey, task.GetID(), s.queueKey(task))
+		pipe.ZAdd(RedisDelayKey, redis.Z{Score: float64(at), Member: task.GetID()})
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	log.Info("task delay: ", task, at)
+	return true, nil
+}
+
+// Promote 将until之前到期的最多size个任务移回队列, 任务路由被并发修改时重新读取
+func (s *RedisStore) Promote(until int64, size int) (int64, error) {
+	for i := 0; i < routeRetryTimes; i++ {
+		ids, err := s.redis.ZRangeByScore(RedisDelayKey, redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(until, 10),
+			Count: int64(size),
+		}).Result()
+		if err != nil {
+			return 0, err
+		}
+		if len(ids) == 0 {
+			return 0, nil
+		}
+		_, queues, err := s.routeKeys(ids)
+		if err != nil {
+			return 0, err
+		}
+		keys := []string{RedisDelayKey, RedisRouteKey, RedisQueuesKey, RedisKey}
+		keys = append(keys, queues...)
+		n, err := promoteScript.Run(s.redis, keys, until, size).Int64()
+		if err != nil {
+			return 0, err
+		}
+		if n >= 0 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("task promote conflict: %d", until)
+}
+
+// Lookup 查询队列、调度区或已取出待确认的任务
+func (s *RedisStore) Lookup(tid string) (task.Tasker, int64, error) {
+	var data, leased *redis.StringCmd
+	var score *redis.FloatCmd
+	_, err := s.redis.Pipelined(func(pipe redis.Pipeliner) error {
+		data = pipe.HGet(RedisDataKey, tid)
+		leased = pipe.HGet(RedisLeasedKey, tid)
+		score = pipe.ZScore(RedisDelayKey, tid)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, 0, err
+	}
+	t, err := data.Result()
+	if errors.Is(err, redis.Nil) {
+		t, err = leased.Result()
+	}
+	if errors.Is(err, redis.Nil) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	task, err := Decode([]byte(t))
+	if err != nil {
+		return nil, 0, err
+	}
+	at, _ := score.Result()
+	return task, int64(at), nil
+}
+
+// Cancel 从业务队列和调度区移除任务并标记为已取消, 任务正在执行时返回CancelRunning
+func (s *RedisStore) Cancel(tid string) (int, error) {
+	//取消标记需要保留到任务原本的执行时间之后
+	item, at, err := s.Lookup(tid)
+	if err != nil {
+		return CancelRunning, err
+	}
+	for i := 0; i < routeRetryTimes; i++ {
+		routes, queues, err := s.routeKeys([]string{tid})
+		if err != nil {
+			return CancelRunning, err
+		}
+		keys := []string{RedisDataKey, RedisRouteKey, RedisDelayKey, RedisLeasedKey, redisCancelPrefix + tid, redisRunPrefix + tid, queues[0]}
+		n, err := cancelScript.Run(s.redis, keys, tid, seconds(CancelTimeOf(item, at)), routes[0]).Int()
+		if err != nil {
+			return CancelRunning, err
+		}
+		if n >= 0 {
+			log.Info("task cancel: ", tid, n)
+			return n, nil
+		}
+	}
+	return CancelRunning, fmt.Errorf("task cancel conflict: %s", tid)
+}
+
+// Acquire 标记任务开始执行, 任务已取消时返回false
+func (s *RedisStore) Acquire(tid string, lifetime time.Duration) (bool, error) {
+	keys := []string{redisCancelPrefix + tid, redisRunPrefix + tid}
+	n, err := acquireScript.Run(s.redis, keys, int(lifetime/time.Second)+1).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Release 清除任务的执行标记
+func (s *RedisStore) Release(tid string) error {
+	return s.redis.Del(redisRunPrefix + tid).Err()
+}
+
+// Patch 修改队列或调度区中未被取出的任务, 任务数据被并发修改时重新读取
+func (s *RedisStore) Patch(tid string, p task.Patch) (int, error) {
+	for i := 0; i < patchRetryTimes; i++ {
+		old, err := s.redis.HGet(RedisDataKey, tid).Result()
+		if errors.Is(err, redis.Nil) {
+			leased, err := s.redis.HExists(RedisLeasedKey, tid).Result()
+			if err != nil {
+				return PatchNotFound, err
+			}
+			if leased {
+				return PatchLeased, nil
+			}
+			return s.patchLegacy(tid, p)
+		}
+		if err != nil {
+			return PatchNotFound, err
+		}
+		item, err := Decode([]byte(old))
+		if err != nil {
+			return PatchNotFound, err
+		}
+		if err := PatchTask(item, p); err != nil {
+			return PatchNotFound, err
+		}
+		data, err := Encode(item)
+		if err != nil {
+			return PatchNotFound, err
+		}
+		at := item.GetExpectTime()
+		if item.GetNextTime() > at {
+			at = item.GetNextTime()
+		}
+		keys := []string{RedisDataKey, RedisLeasedKey, RedisDelayKey}
+		n, err := patchScript.Run(s.redis, keys, tid, old, string(data), at).Int()
+		if err != nil {
+			return PatchNotFound, err
+		}
+		if n != 0 {
+			log.Info("task patch: ", item, n)
+			return n, nil
+		}
+	}
+	return PatchNotFound, fmt.Errorf("task patch conflict: %s", tid)
+}
+
+// patchLegacy 修改旧版本全局队列中的任务
+func (s *RedisStore) patchLegacy(tid string, p task.Patch) (int, error) {
+	items, err := s.redis.LRange(RedisKey, 0, -1).Result()
+	if err != nil {
+		return PatchNotFound, err
+	}
+	for _, old := range items {
+		item, err := Decode([]byte(old))
+		if err != nil || item.GetID() != tid {
+			continue
+		}
+		if err := PatchTask(item, p); err != nil {
+			return PatchNotFound, err
+		}
+		data, err := Encode(item)
+		if err != nil {
+			return PatchNotFound, err
+		}
+		n, err := patchLegacyScript.Run(s.redis, []string{RedisKey}, old, string(data)).Int()
+		if err != nil {
+			return PatchNotFound, err
+		}
+		if n == 0 {
+			//查询后被取出
+			return PatchLeased, nil
+		}
+		log.Info("task patch: ", item)
+		return PatchApplied, nil
+	}
+	return PatchNotFound, nil
+}
+
+// QueueLen 获取业务队列中等待的任务数
+func (s *RedisStore) QueueLen(appId string) (int64, error) {
+	queues, err := s.appQueues(appId)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, q := range queues {
+		n, err := s.redis.LLen(q).Result()
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// Purge 清空业务队列和调度区中该业务的任务, 返回删除的任务数
+func (s *RedisStore) Purge(appId string) (int64, error) {
+	queues, err := s.appQueues(appId)
+	if err != nil {
+		return 0, err
+	}
+	//调度区中的任务按路由所属的业务筛选, 脚本内校验路由未被修改
+	ids, err := s.redis.ZRange(RedisDelayKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	routes, _, err := s.routeKeys(ids)
+	if err != nil {
+		return 0, err
+	}
+	args := make([]interface{}, 0)
+	for i, r := range routes {
+		if strings.HasPrefix(r, redisQueuePrefix) && queueApp(r) == appId {
+			args = append(args, ids[i], r)
+		}
+	}
+	keys := append([]string{RedisDataKey, RedisRouteKey, RedisQueuesKey, RedisDelayKey}, queues...)
+	n, err := purgeScript.Run(s.redis, keys, args...).Int64()
+	if err != nil {
+		return 0, err
+	}
+	log.Info("task purge: ", appId, n)
+	return n, nil
+}
+
+// Migrate 将队列和调度区中的任务数据改写为当前编码格式, 旧版本全局队列中的任务移到所属业务队列
+// 已取出待确认的任务不做改写, 由消费者按原格式识别
+func (s *RedisStore) Migrate() (count int64, err error) {
+	var cursor uint64
+	for {
+		vals, next, err := s.redis.HScan(RedisDataKey, cursor, "", int64(BatchSize)).Result()
+		if err != nil {
+			return count, err
+		}
+		for i := 0; i+1 < len(vals); i += 2 {
+			tid, old := vals[i], vals[i+1]
+			data, ok, err := Recode([]byte(old))
+			if err != nil {
+				log.Error("task migrate err, task: ", tid, " recode err: ", err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			n, err := recodeScript.Run(s.redis, []string{RedisDataKey}, tid, old, string(data)).Int64()
+			if err != nil {
+				return count, err
+			}
+			count += n
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	//从尾部开始逐个移到业务队列头部, 保持原有顺序
+	items, err := s.redis.LRange(RedisKey, 0, -1).Result()
+	if err != nil {
+		return count, err
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		task, err := Decode([]byte(items[i]))
+		if err != nil {
+			log.Error("task migrate err, task: ", items[i], " decode err: ", err)
+			continue
+		}
+		data, err := Encode(task)
+		if err != nil {
+			return count, err
+		}
+		keys := []string{RedisKey, RedisDataKey, RedisRouteKey, RedisQueuesKey, s.queueKey(task)}
+		n, err := upgradeScript.Run(s.redis, keys, items[i], task.GetID(), string(data)).Int64()
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+	log.Info("task migrate: ", count)
+	return count, nil
+}
+
+// Recover 将失效消费者未确认的任务放回队列
+func (s *RedisStore) Recover() (int64, error) {
+	ids, err := s.redis.SMembers(RedisConsumersKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, id := range ids {
+		if id == s.id {
+			continue
+		}
+		alive, err := s.redis.Exists(s.aliveKey(id)).Result()
+		if err != nil {
+			return count, err
+		}
+		if alive > 0 {
+			continue
+		}
+		n, err := s.recover(id)
+		if err != nil {
+			return count, err
+		}
+		_, _ = s.redis.SRem(RedisConsumersKey, id).Result()
+		if n > 0 {
+			log.Info("task recover: ", id, n)
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// recover 将消费者处理中队列的全部任务放回所属业务队列头部, 任务路由被并发修改时重新读取
+func (s *RedisStore) recover(id string) (int64, error) {
+	for i := 0; i < routeRetryTimes; i++ {
+		members, err := s.redis.LRange(s.processingKey(id), 0, -1).Result()
+		if err != nil {
+			return 0, err
+		}
+		_, queues, err := s.routeKeys(members)
+		if err != nil {
+			return 0, err
+		}
+		keys := []string{s.processingKey(id), RedisDataKey, RedisLeasedKey, RedisRouteKey, RedisQueuesKey, RedisKey}
+		keys = append(keys, queues...)
+		n, err := recoverScript.Run(s.redis, keys).Int64()
+		if err != nil {
+			return 0, err
+		}
+		if n >= 0 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("task recover conflict: %s", id)
+}
+
+// requeue 将处理中队列的一个任务放回所属业务队列尾部, 任务路由被并发修改时重新读取
+func (s *RedisStore) requeue(member string) error {
+	for i := 0; i < routeRetryTimes; i++ {
+		routes, queues, err := s.routeKeys([]string{member})
+		if err != nil {
+			return err
+		}
+		keys := []string{s.processingKey(s.id), RedisDataKey, RedisLeasedKey, RedisRouteKey, RedisQueuesKey, queues[0]}
+		n, err := requeueScript.Run(s.redis, keys, member, routes[0]).Int()
+		if err != nil {
+			return err
+		}
+		if n >= 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("task requeue conflict: %s", member)
+}
+
+// routeKeys 读取队列成员的任务路由, 返回与members一一对应的路由(没有路由时为空)和去重后的所属队列key
+// 没有路由的成员属于旧版本全局队列
+func (s *RedisStore) routeKeys(members []string) ([]string, []string, error) {
+	routes := make([]string, len(members))
+	queues := make([]string, 0)
+	if len(members) == 0 {
+		return routes, queues, nil
+	}
+	vals, err := s.redis.HMGet(RedisRouteKey, members...).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool)
+	for i, v := range vals {
+		q := RedisKey
+		if r, ok := v.(string); ok {
+			routes[i], q = r, r
+		}
+		if !seen[q] {
+			seen[q] = true
+			queues = append(queues, q)
+		}
+	}
+	return routes, queues, nil
+}
+
 // Generate 生成一个token
 func (s *RedisStore) Generate(tid string, lifetime time.Duration) (token string, err error) {
 	token = randstr.New(32)
@@ -80,13 +881,219 @@ func (s *RedisStore) Check(tid, token string) (ok bool, err error) {
 	return t == token, nil
 }
 
+// Reserve 在lifetime内将业务的幂等键绑定到任务ID, 已绑定其他任务时返回原任务ID和false
+func (s *RedisStore) Reserve(appId, key, tid string, lifetime time.Duration) (string, bool, error) {
+	keys := []string{redisIdempotencyPrefix + appId + ":" + key}
+	v, err := reserveScript.Run(s.redis, keys, tid, seconds(lifetime)).String()
+	if err != nil {
+		return "", false, err
+	}
+	return v, v == tid, nil
+}
+
+// Forget 解除幂等键与任务ID的绑定
+func (s *RedisStore) Forget(appId, key, tid string) error {
+	keys := []string{redisIdempotencyPrefix + appId + ":" + key}
+	return forgetScript.Run(s.redis, keys, tid).Err()
+}
+
+// Lock 在lifetime内将业务唯一键绑定到任务ID, 已绑定其他任务时返回该任务ID和false
+func (s *RedisStore) Lock(appId, key, tid string, lifetime time.Duration) (string, bool, error) {
+	keys := []string{redisUniquePrefix + appId + ":" + key}
+	v, err := reserveScript.Run(s.redis, keys, tid, seconds(lifetime)).String()
+	if err != nil {
+		return "", false, err
+	}
+	return v, v == tid, nil
+}
+
+// Relock 唯一键仍绑定old(或已过期)时改为绑定tid
+func (s *RedisStore) Relock(appId, key, old, tid string, lifetime time.Duration) (bool, error) {
+	keys := []string{redisUniquePrefix + appId + ":" + key}
+	n, err := relockScript.Run(s.redis, keys, old, tid, seconds(lifetime)).Int()
+	return n == 1, err
+}
+
+// Unlock 唯一键仍绑定tid时解除绑定
+func (s *RedisStore) Unlock(appId, key, tid string) error {
+	keys := []string{redisUniquePrefix + appId + ":" + key}
+	return forgetScript.Run(s.redis, keys, tid).Err()
+}
+
+// Elect 竞选或续期name的执行者, 任期为lifetime
+func (s *RedisStore) Elect(name, id string, lifetime time.Duration) (bool, error) {
+	n, err := electScript.Run(s.redis, []string{redisLeaderPrefix + name}, id, int64(lifetime/time.Millisecond)).Int()
+	return n == 1, err
+}
+
+// pollQueues 返回本次拉取的业务队列顺序, 高优先级的队列在前, 同优先级的各业务按权重轮流排在首位
+func (s *RedisStore) pollQueues() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.refreshAt) > RedisQueuesRefresh {
+		keys, err := s.redis.SMembers(RedisQueuesKey).Result()
+		if err != nil {
+			return nil, err
+		}
+		s.levels = pollLevels(keys, s.levels)
+		s.refreshAt = time.Now()
+	}
+	queues := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, l := range s.levels {
+		for i := range l.rounds {
+			q := l.rounds[(l.cursor+i)%len(l.rounds)]
+			if !seen[q] {
+				seen[q] = true
+				queues = append(queues, q)
+			}
+		}
+	}
+	//兼容旧版本的全局队列
+	if !seen[RedisKey] {
+		queues = append(queues, RedisKey)
+	}
+	return queues, nil
+}
+
+// advance 取到任务后推进该队列所在优先级的轮询位置
+func (s *RedisStore) advance(queue string) {
+	if !strings.HasPrefix(queue, redisQueuePrefix) {
+		return
+	}
+	priority := queuePriority(queue)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.levels {
+		if l.priority == priority && len(l.rounds) > 0 {
+			l.cursor = (l.cursor + 1) % len(l.rounds)
+			return
+		}
+	}
+}
+
+// appQueues 返回业务的全部队列
+func (s *RedisStore) appQueues(appId string) ([]string, error) {
+	keys, err := s.redis.SMembers(RedisQueuesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	queues := make([]string, 0)
+	for _, k := range keys {
+		if strings.HasPrefix(k, redisQueuePrefix) && queueApp(k) == appId {
+			queues = append(queues, k)
+		}
+	}
+	return queues, nil
+}
+
+// queueKey 任务所属的业务队列key
+func (s *RedisStore) queueKey(task task.Tasker) string {
+	key := redisQueuePrefix + strconv.Itoa(PriorityOf(task)) + ":" + task.GetAppID()
+	if app.Config.Redis.ShardByType {
+		key += ":" + task.GetType()
+	}
+	return key
+}
+
+// queuePriority 从业务队列key中解析优先级
+func queuePriority(key string) int {
+	parts := strings.SplitN(strings.TrimPrefix(key, redisQueuePrefix), ":", 3)
+	priority, _ := strconv.Atoi(parts[0])
+	return priority
+}
+
+// queueApp 从业务队列key中解析业务ID
+func queueApp(key string) string {
+	parts := strings.SplitN(strings.TrimPrefix(key, redisQueuePrefix), ":", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// pollLevels 将业务队列按优先级分层, 沿用已有层的轮询位置
+func pollLevels(keys []string, old []*pollLevel) []*pollLevel {
+	sort.Strings(keys)
+	group := make(map[int][]string)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, redisQueuePrefix) {
+			continue
+		}
+		p := queuePriority(k)
+		group[p] = append(group[p], k)
+	}
+	cursors := make(map[int]int, len(old))
+	for _, l := range old {
+		cursors[l.priority] = l.cursor
+	}
+	levels := make([]*pollLevel, 0, len(group))
+	for p, ks := range group {
+		rounds := weightedRounds(ks)
+		levels = append(levels, &pollLevel{priority: p, rounds: rounds, cursor: cursors[p] % len(rounds)})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].priority > levels[j].priority
+	})
+	return levels
+}
+
+// weightedRounds 按redis.weights配置的业务权重平滑展开轮询顺序, 未配置的权重为1
+func weightedRounds(keys []string) []string {
+	weights := make([]int, len(keys))
+	total := 0
+	for i, k := range keys {
+		w := app.Config.Redis.Weights[queueApp(k)]
+		if w <= 0 {
+			w = 1
+		}
+		weights[i] = w
+		total += w
+	}
+	current := make([]int, len(keys))
+	rounds := make([]string, 0, total)
+	for n := 0; n < total; n++ {
+		best := 0
+		for i := range keys {
+			current[i] += weights[i]
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		rounds = append(rounds, keys[best])
+	}
+	return rounds
+}
+
+// processingKey 消费者处理中队列key
+func (s *RedisStore) processingKey(id string) string {
+	return redisProcessingPrefix + id
+}
+
+// aliveKey 消费者心跳key
+func (s *RedisStore) aliveKey(id string) string {
+	return redisAlivePrefix + id
+}
+
 // NewRedisStore redis construct
 func NewRedisStore() *RedisStore {
-	return &RedisStore{redis.NewClient(&redis.Options{
-		Addr:         app.Config.Redis.Addr,
-		Password:     app.Config.Redis.Password,
-		DB:           app.Config.Redis.Db,
-		IdleTimeout:  20 * time.Second,
-		MinIdleConns: 1,
-	})}
+	return &RedisStore{
+		redis: redis.NewClient(&redis.Options{
+			Addr:         app.Config.Redis.Addr,
+			Password:     app.Config.Redis.Password,
+			DB:           app.Config.Redis.Db,
+			IdleTimeout:  20 * time.Second,
+			MinIdleConns: 1,
+		}),
+		id: app.ClientId() + "-" + randstr.New(8),
+	}
+}
+
+// seconds 将有效期转换为redis过期秒数, 最少1秒
+func seconds(lifetime time.Duration) int {
+	if n := int(lifetime / time.Second); n > 0 {
+		return n
+	}
+	return 1
 }
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/meixiu/utask/app"
+	"github.com/meixiu/utask/log"
+	"github.com/meixiu/utask/task"
+
+	_ "github.com/mattn/go-sqlite3"
+	"xorm.io/xorm"
+)
+
+// NewSqliteStore 返回一个新SqliteStore对象
+func NewSqliteStore() *SqliteStore {
+	db, err := xorm.NewEngine(app.Config.Db.Driver, app.Config.Db.Source)
+	if err != nil {
+		log.Error("database err: ", err)
+		return nil
+	}
+	// sqlite同一时刻只允许一个写入, 使用单连接避免database is locked
+	db.SetMaxOpenConns(1)
+	db.ShowSQL(false)
+
+	_ = db.Sync2(&TaskItem{}, &TaskLog{}, &TaskSchedule{}, &TaskWorkflow{}, &TaskWorkflowNode{})
+	buryExhausted(db)
+	return &SqliteStore{MysqlStore{db}}
+}
+
+// SqliteStore 是一个使用嵌入式sqlite实现的logStore，processStore
+// 与MysqlStore共用表结构, 仅替换sqlite不支持的UPDATE ... ORDER BY ... LIMIT语句
+type SqliteStore struct {
+	MysqlStore
+}
+
+func (s *SqliteStore) Get(cid string, size int) (data []task.Tasker, err error) {
+	log.Info("task process get: ", cid, size)
+
+	lockTime := time.Now().Unix()
+	lockID := uuid.New().String()
+
+	// 悲观获取, sqlite写入是串行的, 子查询和更新在同一语句中完成, 与MysqlStore相同按任务超时时间加MaxLockTime租用
+	rst, err := s.db.Exec(`UPDATE task_item
+SET lock_status = 1, lock_id = ?, lock_time = ? + CASE WHEN timeout > 0 THEN timeout + ? ELSE ? END, times = times + 1, cid = ?
+WHERE id IN (SELECT id FROM task_item
+WHERE cid = ? AND times < CASE WHEN max_times > 0 THEN max_times ELSE ? END AND lock_time < ? AND lock_status <> ?
+ORDER BY priority DESC, lock_time ASC
+LIMIT ?)`, lockID, lockTime, MaxLockTime, MaxLockTime, cid, cid, MaxRetryTimes, lockTime, LockStatusDead, size)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rst.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, err
+	}
+	return s.fetch(cid, lockID, size)
+}
+
+func (s *SqliteStore) Steal(cid string, size int) (int64, error) {
+	log.Info("task process steal: ", cid)
+
+	rst, err := s.db.Exec(`UPDATE task_item SET cid = ? WHERE id IN (SELECT id FROM task_item WHERE cid = ? ORDER BY create_time ASC LIMIT ?)`,
+		cid, StealTag, size)
+	if err != nil {
+		return 0, err
+	}
+	return rst.RowsAffected()
+}
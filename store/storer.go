@@ -2,8 +2,12 @@ package store
 
 import (
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/meixiu/utask/app"
+	"github.com/meixiu/utask/pkg/retry"
 	"github.com/meixiu/utask/store/coder"
 	"github.com/meixiu/utask/task"
 )
@@ -23,6 +27,75 @@ type ConfirmTaskStorer interface {
 	Confirm(tid string) error
 }
 
+// QueueTaskStorer 按业务分队列的数据源
+type QueueTaskStorer interface {
+	TaskStorer
+	//QueueLen 获取业务队列中等待的任务数
+	QueueLen(appId string) (int64, error)
+	//Purge 清空业务队列, 返回删除的任务数
+	Purge(appId string) (int64, error)
+}
+
+// RecoverTaskStorer 能回收失效消费者任务的数据源
+type RecoverTaskStorer interface {
+	ConfirmTaskStorer
+	//Recover 将失效消费者未确认的任务放回数据源
+	Recover() (int64, error)
+}
+
+// LookupTaskStorer 能根据任务ID查询任务的数据源
+type LookupTaskStorer interface {
+	TaskStorer
+	//Lookup 查询数据源中的任务及调度区中的到期时间(不在调度区时为0), 不存在时返回nil
+	Lookup(tid string) (task.Tasker, int64, error)
+}
+
+// CancelTaskStorer 能取消任务的数据源
+// 取消与执行通过标记互斥: 取消时任务正在执行则失败, 取消后已被拉取的任务也不会再执行
+type CancelTaskStorer interface {
+	TaskStorer
+	//Cancel 从数据源移除任务并标记为已取消, 任务正在执行时返回CancelRunning
+	Cancel(tid string) (int, error)
+	//Acquire 标记任务开始执行, 任务已取消时返回false
+	Acquire(tid string, lifetime time.Duration) (bool, error)
+	//Release 清除任务的执行标记
+	Release(tid string) error
+}
+
+// PatchTaskStorer 能修改未被取出的任务的数据源
+type PatchTaskStorer interface {
+	TaskStorer
+	//Patch 修改数据源中的任务, 返回PatchApplied、PatchLeased或PatchNotFound
+	Patch(tid string, p task.Patch) (int, error)
+}
+
+// BatchTaskStorer 能批量增加任务的数据源
+type BatchTaskStorer interface {
+	TaskStorer
+	//RPushBatch 批量增加任务到数据源, 返回每个任务的错误; 整批写入失败时返回error
+	RPushBatch(tasks []task.Tasker) ([]error, error)
+}
+
+// UniqueTaskStorer 能按业务唯一键加锁的数据源
+type UniqueTaskStorer interface {
+	TaskStorer
+	//Lock 在lifetime内将业务唯一键绑定到任务ID, 已绑定其他任务时返回该任务ID和false
+	Lock(appId, key, tid string, lifetime time.Duration) (string, bool, error)
+	//Relock 唯一键仍绑定old时改为绑定tid
+	Relock(appId, key, old, tid string, lifetime time.Duration) (bool, error)
+	//Unlock 唯一键仍绑定tid时解除绑定
+	Unlock(appId, key, tid string) error
+}
+
+// DelayTaskStorer 能按到期时间调度延时、重试任务的数据源
+type DelayTaskStorer interface {
+	TaskStorer
+	//Delay 将任务加入调度区, 在at时间到期
+	Delay(task task.Tasker, at int64) (bool, error)
+	//Promote 将until之前到期的最多size个任务移回数据源
+	Promote(until int64, size int) (int64, error)
+}
+
 // TaskStorer 任务处理区
 type ProcessStorer interface {
 	//Get 根据客户端、拉取个数从任务处理区拉取任务
@@ -44,12 +117,66 @@ type StealProcessStorer interface {
 	Steal(cid string, size int) (int64, error)
 }
 
+// DeadProcessStorer 能将任务移入死信状态的任务处理区
+type DeadProcessStorer interface {
+	ProcessStorer
+	// Bury 将任务标记为死信, reason为原因
+	Bury(cid string, task task.Tasker, reason string) (bool, error)
+	// Dead 分页获取业务的死信任务, 同时返回死信任务总数
+	Dead(appId string, offset, size int) ([]TaskItem, int64, error)
+	// Revive 重置业务死信任务的执行次数, 交给消费者重新执行; tids为空时处理全部
+	Revive(appId string, tids []string) (int64, error)
+	// Discard 删除业务的死信任务; tids为空时删除全部
+	Discard(appId string, tids []string) (int64, error)
+}
+
+// CancelProcessStorer 能取消任务的任务处理区
+type CancelProcessStorer interface {
+	ProcessStorer
+	// Remove 根据任务ID删除任务, 不限消费者
+	Remove(tid string) (bool, error)
+}
+
+// PatchProcessStorer 能修改未被锁定的任务的任务处理区
+type PatchProcessStorer interface {
+	ProcessStorer
+	// Patch 修改任务处理区中的任务, 返回PatchApplied、PatchLeased、PatchDead或PatchNotFound
+	Patch(tid string, p task.Patch) (int, error)
+}
+
+// ClaimProcessStorer 能修改时间轮中等待执行的任务的任务处理区
+type ClaimProcessStorer interface {
+	ProcessStorer
+	// Claim 时间轮中的任务开始执行前改为锁定状态, 任务已被修改、删除或被其他消费者取出时返回false
+	Claim(cid string, tid string) (bool, error)
+}
+
+// UniqueProcessStorer 能按业务唯一键查询任务的任务处理区
+type UniqueProcessStorer interface {
+	ProcessStorer
+	// Unique 查询业务唯一键对应的最新一个非死信任务, 不存在时返回nil
+	Unique(appId, key string) (*TaskItem, error)
+}
+
+// FindProcessStorer 能根据任务ID查询的任务处理区
+type FindProcessStorer interface {
+	// Find 根据任务ID查询任务, 不存在时返回nil
+	Find(tid string) (*TaskItem, error)
+}
+
 // LogStorer 任务日志区
 type LogStorer interface {
 	//Log 插入一条任务日志到日志区
 	Log(cid string, task task.Tasker) error
 }
 
+// HistoryLogStorer 能查询任务执行日志的日志区
+type HistoryLogStorer interface {
+	LogStorer
+	// History 根据任务ID查询任务的全部执行日志, 按执行顺序排列
+	History(tid string) ([]TaskLog, error)
+}
+
 // SecretStorer 任务日志区
 type SecretStorer interface {
 	//Generate 生成一个token
@@ -58,6 +185,254 @@ type SecretStorer interface {
 	Check(tid, token string) (ok bool, err error)
 }
 
+// IdempotentStorer 能按业务幂等键去重推送的存储
+type IdempotentStorer interface {
+	//Reserve 在lifetime内将业务的幂等键绑定到任务ID, 已绑定其他任务时返回原任务ID和false
+	Reserve(appId, key, tid string, lifetime time.Duration) (string, bool, error)
+	//Forget 解除幂等键与任务ID的绑定, 推送失败时调用以允许重试
+	Forget(appId, key, tid string) error
+}
+
+const (
+	// CancelRunning 任务正在执行, 取消失败
+	CancelRunning = 0
+	// CancelRemoved 任务已从数据源移除
+	CancelRemoved = 1
+	// CancelMarked 任务不在数据源中, 仅标记为已取消
+	CancelMarked = 2
+)
+
+const (
+	// WorkflowRunning 工作流运行中
+	WorkflowRunning = 0
+	// WorkflowSucceeded 工作流全部节点执行成功
+	WorkflowSucceeded = 1
+	// WorkflowFailed 工作流有节点成为死信或被取消
+	WorkflowFailed = 2
+
+	// NodeWaiting 节点等待依赖的节点执行成功
+	NodeWaiting = 0
+	// NodePushed 节点任务已推送
+	NodePushed = 1
+	// NodeSucceeded 节点任务执行成功
+	NodeSucceeded = 2
+	// NodeFailed 节点任务成为死信或被取消
+	NodeFailed = 3
+	// NodeSkipped 工作流失败, 节点不再执行
+	NodeSkipped = 4
+)
+
+const (
+	// PatchNotFound 任务不存在
+	PatchNotFound = 0
+	// PatchApplied 任务已修改
+	PatchApplied = 1
+	// PatchLeased 任务已被消费者取出或锁定, 修改失败
+	PatchLeased = 2
+	// PatchDead 死信任务不能修改
+	PatchDead = 3
+
+	// patchRetryTimes 修改任务时并发冲突的重试次数
+	patchRetryTimes = 3
+)
+
+var (
+	// ErrPatchNotSupport 任务类型不支持修改
+	ErrPatchNotSupport = errors.New("task type not support patch")
+	// ErrPatchInvalid 修改后的任务校验失败
+	ErrPatchInvalid = errors.New("task patch invalid")
+)
+
+// PatchTask 修改一个未执行的任务
+func PatchTask(item task.Tasker, p task.Patch) error {
+	pt, ok := item.(task.Patcher)
+	if !ok {
+		return ErrPatchNotSupport
+	}
+	if err := pt.Patch(p); err != nil {
+		return fmt.Errorf("%w: %v", ErrPatchInvalid, err)
+	}
+	return nil
+}
+
+// ScheduleStorer 周期任务计划区
+type ScheduleStorer interface {
+	// AddSchedule 新增一个计划
+	AddSchedule(sc *TaskSchedule) error
+	// GetSchedule 根据计划ID查询计划, 不存在时返回nil
+	GetSchedule(id string) (*TaskSchedule, error)
+	// ListSchedules 分页获取业务的计划, 同时返回计划总数
+	ListSchedules(appId string, offset, size int) ([]TaskSchedule, int64, error)
+	// DueSchedules 获取until之前到期且未暂停的最多size个计划
+	DueSchedules(until int64, size int) ([]TaskSchedule, error)
+	// AdvanceSchedule 计划的下次执行时间仍为prev时改为next, last为本次执行时间
+	AdvanceSchedule(id string, prev, next, last int64) (bool, error)
+	// PauseSchedule 暂停计划; paused为false时恢复计划并从next开始执行
+	PauseSchedule(id string, paused bool, next int64) (bool, error)
+	// RemoveSchedule 删除计划
+	RemoveSchedule(id string) (bool, error)
+}
+
+// WorkflowStorer 工作流区
+type WorkflowStorer interface {
+	// AddWorkflow 新增工作流及其全部节点
+	AddWorkflow(wf *TaskWorkflow, nodes []TaskWorkflowNode) error
+	// GetWorkflow 查询工作流及其全部节点, 不存在时返回nil
+	GetWorkflow(id string) (*TaskWorkflow, []TaskWorkflowNode, error)
+	// NodeOf 根据任务ID查询工作流节点, 不存在时返回nil
+	NodeOf(tid string) (*TaskWorkflowNode, error)
+	// SetNode 节点状态仍为from时改为to, tid不为空时同时记录节点的任务ID
+	SetNode(id int, from, to int, tid string) (bool, error)
+	// FinishWorkflow 运行中的工作流结束为status, reason为失败原因
+	FinishWorkflow(id string, status int, reason string) (bool, error)
+	// StalledWorkflows 查询before之前创建、没有已推送节点的最多size个运行中工作流ID
+	StalledWorkflows(before int64, size int) ([]string, error)
+}
+
+// LeaderStorer 能在集群中选举唯一执行者的存储
+type LeaderStorer interface {
+	// Elect 竞选或续期name的执行者, 任期为lifetime, 当选时返回true
+	Elect(name, id string, lifetime time.Duration) (bool, error)
+}
+
+// MigrateStorer 能将已存储的任务数据改写为当前编码格式的数据源
+type MigrateStorer interface {
+	//Migrate 改写全部非首选格式的任务数据, 返回改写条数
+	Migrate() (int64, error)
+}
+
+// UniqueKeyOf 返回任务的业务唯一键, 任务类型不支持时为空
+func UniqueKeyOf(item task.Tasker) string {
+	if v, ok := item.(task.Unique); ok {
+		return v.GetUniqueKey()
+	}
+	return ""
+}
+
+// RetryPolicyOf 返回任务生效的重试策略
+// 依次使用任务、业务、全局的重试策略, 最大执行次数为0时使用db.max_retry_times
+func RetryPolicyOf(item task.Tasker) retry.Policy {
+	p := app.Config.Retry.Default
+	if v, ok := app.Config.Retry.Apps[item.GetAppID()]; ok {
+		p = v
+	}
+	if r, ok := item.(task.Retrier); ok && r.GetRetryPolicy() != nil {
+		p = *r.GetRetryPolicy()
+	}
+	if p.MaxTimes <= 0 {
+		p.MaxTimes = item.MaxRetryTimes()
+	}
+	if p.MaxTimes <= 0 {
+		p.MaxTimes = MaxRetryTimes
+	}
+	return p
+}
+
+// Retry 增加任务的执行次数并按重试策略设置下次执行时间, 返回是否已达到最大执行次数
+func Retry(item task.Tasker) bool {
+	p := RetryPolicyOf(item)
+	item.IncreaseTimes()
+	if r, ok := item.(task.Retrier); ok {
+		r.SetNextTime(time.Now().Unix() + p.Delay(item.GetTimes()))
+	}
+	return item.GetTimes() >= int64(p.MaxTimes)
+}
+
+// MaxTimesOf 返回处理区任务的最大执行次数, 旧版本写入的任务使用db.max_retry_times
+func MaxTimesOf(v *TaskItem) int64 {
+	if v.MaxTimes > 0 {
+		return v.MaxTimes
+	}
+	return int64(MaxRetryTimes)
+}
+
+// LockTimeOf 返回任务在处理区的锁定时间
+// 待处理队列中的任务在到期后的两倍超时时间内保持锁定, 其他任务锁定到下次执行时间
+func LockTimeOf(task task.Tasker) int64 {
+	lockTime := task.GetNextTime()
+	if lockTime < task.GetExpectTime() {
+		lockTime = task.GetExpectTime()
+	}
+	if !task.IsProcessing() {
+		return lockTime
+	}
+	if now := time.Now().Unix(); lockTime < now {
+		lockTime = now
+	}
+	return lockTime + task.Timeout()*2
+}
+
+// CancelTimeOf 返回任务取消标记的有效期, at为任务在调度区的到期时间
+// 不短于RedisCancelTime, 未到期的任务保留到到期后再加两倍超时时间, 覆盖任务在消费者中等待和执行的时间
+func CancelTimeOf(task task.Tasker, at int64) time.Duration {
+	if task == nil {
+		return RedisCancelTime
+	}
+	if at < task.GetNextTime() {
+		at = task.GetNextTime()
+	}
+	if at < task.GetExpectTime() {
+		at = task.GetExpectTime()
+	}
+	lifetime := time.Until(time.Unix(at+task.Timeout()*2, 0))
+	if lifetime < RedisCancelTime {
+		return RedisCancelTime
+	}
+	return lifetime
+}
+
+// PriorityOf 返回任务的优先级, 任务类型未实现task.Prioritizer时为task.PriorityNormal
+func PriorityOf(item task.Tasker) int {
+	if v, ok := item.(task.Prioritizer); ok {
+		return v.GetPriority()
+	}
+	return task.PriorityNormal
+}
+
+// ResetTimes 重置任务的执行次数, 任务类型未实现task.Resetter时不做处理
+func ResetTimes(item task.Tasker) {
+	if v, ok := item.(task.Resetter); ok {
+		v.ResetTimes()
+	}
+}
+
+// UnsetProcessing 设置任务离开待处理队列, 任务类型未实现task.Processor时不做处理
+func UnsetProcessing(item task.Tasker) {
+	if v, ok := item.(task.Processor); ok {
+		v.UnsetProcessing()
+	}
+}
+
+// LockStatusOf 返回任务写入任务处理区的锁定状态, 执行中的任务由消费者调度等待执行, 开始执行前由消费者Claim
+// 未在执行中的任务返回0, 更新时不修改锁定状态
+func LockStatusOf(task task.Tasker) int {
+	if task.IsProcessing() {
+		return LockStatusHeld
+	}
+	return 0
+}
+
+// DbStorer 数据库实现的任务处理区和日志区
+type DbStorer interface {
+	StealProcessStorer
+	LogStorer
+}
+
+// NewDbStore 根据db.driver配置返回对应的db store
+func NewDbStore() DbStorer {
+	switch app.Config.Db.Driver {
+	case "sqlite3":
+		return NewSqliteStore()
+	case "postgres":
+		return NewPostgresStore()
+	default:
+		return NewMysqlStore()
+	}
+}
+
+// BatchSize 批量改写任务处理区时单批处理的条数
+var BatchSize = 100
+
 // defaultCoder 默认的编码器
 var defaultCoder coder.Coder
 
@@ -66,6 +441,15 @@ func SetCoder(c coder.Coder) {
 	defaultCoder = c
 }
 
+// NewCoder 根据名称返回编码器, 名称为空时为gob, 读取时识别全部格式, 未知名称返回错误
+func NewCoder(name string) (coder.Coder, error) {
+	c, err := coder.NewMultiCoder(name)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 // Encode 调用defaultCoder序列化任务
 func Encode(task task.Tasker) (data []byte, err error) {
 	return defaultCoder.Encode(task)
@@ -76,10 +460,53 @@ func Decode(data []byte) (task task.Tasker, err error) {
 	return defaultCoder.Decode(data)
 }
 
+// Recode 将任务数据改写为defaultCoder的首选格式, 已是首选格式时返回false
+func Recode(data []byte) ([]byte, bool, error) {
+	if c, ok := defaultCoder.(coder.Preferrer); ok && c.IsPreferred(data) {
+		return data, false, nil
+	}
+	task, err := Decode(data)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err = Encode(task)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
 func init() {
 	//任务对象注册gob
 	for _, v := range task.GetRegister() {
 		gob.Register(v())
 	}
-	SetCoder(coder.NewGobCoder())
+	//调用Init前使用gob格式写入, 读取时识别全部格式
+	c, _ := NewCoder(coder.FormatGob)
+	SetCoder(c)
+}
+
+// Init 按app.Config设置编码器并创建默认数据源, 需要在app.Load之后、创建生产者和消费者之前调用
+func Init() error {
+	MaxLockTime = app.Config.Db.MaxLockTime
+	MaxRetryTimes = app.Config.Db.MaxRetryTimes
+	c, err := NewCoder(app.Config.Coder)
+	if err != nil {
+		return err
+	}
+	if app.Config.Crypto.Enable {
+		k, err := newKeyring()
+		if err != nil {
+			return err
+		}
+		defaultKeyring = k
+		c = coder.NewCryptoCoder(c, k)
+	}
+	SetCoder(c)
+	DefaultRedisStore = NewRedisStore()
+	DefaultDbStore = NewDbStore()
+	if s, ok := DefaultDbStore.(*MysqlStore); ok {
+		DefaultMysqlStore = s
+	}
+	return nil
 }
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meixiu/utask/pkg/retry"
+	"github.com/meixiu/utask/task"
+)
+
+func TestCancelTimeOf(t *testing.T) {
+	now := time.Now().Unix()
+	day := int64(RedisCancelTime / time.Second)
+	cases := []struct {
+		name string
+		item task.Tasker
+		at   int64
+		want int64 // 有效期(秒)
+	}{
+		{"not found", nil, 0, day},
+		{"queued", &task.HttpTask{ExecTimeout: 60}, 0, day},
+		{"far expect", &task.HttpTask{ExpectTime: now + 2*day, ExecTimeout: 60}, 0, 2*day + 120},
+		{"far retry", &task.HttpTask{NextTime: now + 3*day, ExecTimeout: 60}, 0, 3*day + 120},
+		{"far delay", &task.HttpTask{ExecTimeout: 60}, now + 2*day, 2*day + 120},
+	}
+	for _, c := range cases {
+		got := int64(CancelTimeOf(c.item, c.at) / time.Second)
+		//计算期间时间可能前进1秒
+		if got < c.want-1 || got > c.want {
+			t.Errorf("%s: CancelTimeOf() = %ds, want %ds", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := &retry.Policy{Strategy: retry.Fixed, Interval: 30, MaxTimes: 3}
+	item := &task.HttpTask{AppID: "100", Retry: policy}
+	for i := int64(1); i <= 3; i++ {
+		now := time.Now().Unix()
+		exhausted := Retry(item)
+		if item.GetTimes() != i || exhausted != (i == 3) {
+			t.Errorf("Retry() #%d = %v, times %d", i, exhausted, item.GetTimes())
+		}
+		//下次执行时间只由重试策略决定
+		if d := item.GetNextTime() - now; d < 30 || d > 31 {
+			t.Errorf("Retry() #%d next time after %ds, want 30s", i, d)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	ContentJSON   = "json"   // body为JSON原文, 默认
+	ContentForm   = "form"   // body为JSON对象, 按form-urlencoded编码发送
+	ContentText   = "text"   // body为纯文本原文
+	ContentXML    = "xml"    // body为XML原文
+	ContentBinary = "binary" // body为base64编码的二进制内容, 解码后发送
+)
+
+// contentTypes 请求内容类型对应的Content-Type
+var contentTypes = map[string]string{
+	ContentJSON:   "application/json",
+	ContentForm:   "application/x-www-form-urlencoded",
+	ContentText:   "text/plain; charset=utf-8",
+	ContentXML:    "application/xml",
+	ContentBinary: "application/octet-stream",
+}
+
+// contentAliases 兼容直接传入Content-Type的请求内容类型
+var contentAliases = map[string]string{
+	"application/json":                  ContentJSON,
+	"application/x-www-form-urlencoded": ContentForm,
+	"text/plain":                        ContentText,
+	"application/xml":                   ContentXML,
+	"text/xml":                          ContentXML,
+	"application/octet-stream":          ContentBinary,
+}
+
+// httpMethods 支持的请求方法, 除GET外都发送body
+var httpMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// method 返回请求方法, 默认为GET
+func (t HttpTask) method() string {
+	if t.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(t.Method)
+}
+
+// contentType 返回请求内容类型, 默认为ContentJSON
+func (t HttpTask) contentType() string {
+	c := strings.ToLower(strings.TrimSpace(t.ContentType))
+	if c == "" {
+		return ContentJSON
+	}
+	if i := strings.Index(c, ";"); i >= 0 {
+		c = strings.TrimSpace(c[:i])
+	}
+	if v, ok := contentAliases[c]; ok {
+		return v
+	}
+	return c
+}
+
+// Normalize 旧版本推送的任务未校验method和content_type, 不支持的请求方法按旧版本发送GET请求, 不支持的内容类型按JSON发送
+func (t *HttpTask) Normalize() bool {
+	changed := false
+	if !httpMethods[t.method()] {
+		t.Method = http.MethodGet
+		changed = true
+	}
+	if _, ok := contentTypes[t.contentType()]; !ok {
+		t.ContentType = ContentJSON
+		changed = true
+	}
+	return changed
+}
+
+// validateRequest 校验请求方法、地址、请求头和body格式
+func (t HttpTask) validateRequest() error {
+	if !httpMethods[t.method()] {
+		return fmt.Errorf("incorrect parameter: %s", "method")
+	}
+	if u, err := url.Parse(t.URL); err != nil || u.Host == "" {
+		return fmt.Errorf("incorrect parameter: %s", "url")
+	}
+	for k := range t.Headers {
+		if k == "" || http.CanonicalHeaderKey(k) == headerUTaskId || http.CanonicalHeaderKey(k) == headerUTaskToken {
+			return fmt.Errorf("incorrect parameter: header %q", k)
+		}
+	}
+	if _, ok := contentTypes[t.contentType()]; !ok {
+		return fmt.Errorf("incorrect parameter: %s", "content_type")
+	}
+	if _, err := t.body(); err != nil {
+		return fmt.Errorf("incorrect parameter: body, %w", err)
+	}
+	return nil
+}
+
+// isHttpURL 判断是否为带主机的http或https地址
+func isHttpURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// body 按请求内容类型编码body
+func (t HttpTask) body() ([]byte, error) {
+	switch t.contentType() {
+	case ContentForm:
+		if t.Body == "" {
+			return nil, nil
+		}
+		m := make(map[string]interface{})
+		d := json.NewDecoder(strings.NewReader(t.Body))
+		d.UseNumber()
+		if err := d.Decode(&m); err != nil {
+			return nil, err
+		}
+		form := url.Values{}
+		for k, v := range m {
+			switch v := v.(type) {
+			case []interface{}:
+				for _, s := range v {
+					form.Add(k, fmt.Sprint(s))
+				}
+			case nil:
+				form.Add(k, "")
+			default:
+				form.Add(k, fmt.Sprint(v))
+			}
+		}
+		return []byte(form.Encode()), nil
+	case ContentBinary:
+		return base64.StdEncoding.DecodeString(t.Body)
+	default:
+		return []byte(t.Body), nil
+	}
+}
+
+// request 生成执行任务的http请求, ctx超时时取消请求
+func (t HttpTask) request(ctx context.Context, token string) (*http.Request, error) {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Query) > 0 {
+		q := u.Query()
+		for k, v := range t.Query {
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+	}
+	method := t.method()
+	var reader io.Reader
+	if method != http.MethodGet {
+		b, err := t.body()
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", contentTypes[t.contentType()])
+	}
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(headerUTaskId, t.ID)
+	req.Header.Set(headerUTaskToken, token)
+	return req, nil
+}
@@ -0,0 +1,34 @@
+package task
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		name        string
+		method      string
+		contentType string
+		changed     bool
+		wantMethod  string
+		wantContent string
+	}{
+		{"supported", "post", "form", false, http.MethodPost, ContentForm},
+		{"default", "", "", false, http.MethodGet, ContentJSON},
+		{"legacy method", "HEAD", "", true, http.MethodGet, ContentJSON},
+		{"legacy content type", "POST", "application/yaml", true, http.MethodPost, ContentJSON},
+	}
+	for _, c := range cases {
+		item := &HttpTask{AppID: "100", URL: "http://example.com", Method: c.method, ContentType: c.contentType}
+		if changed := item.Normalize(); changed != c.changed {
+			t.Errorf("%s: Normalize() = %v, want %v", c.name, changed, c.changed)
+		}
+		if item.method() != c.wantMethod || item.contentType() != c.wantContent {
+			t.Errorf("%s: method %s content_type %s, want %s %s", c.name, item.method(), item.contentType(), c.wantMethod, c.wantContent)
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("%s: Validate() after Normalize = %v", c.name, err)
+		}
+	}
+}
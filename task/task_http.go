@@ -4,13 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/meixiu/utask/app"
 	"github.com/meixiu/utask/log"
-
-	"github.com/meixiu/httpclient"
+	"github.com/meixiu/utask/pkg/retry"
+	"github.com/meixiu/utask/pkg/success"
 
 	"github.com/google/uuid"
 )
@@ -32,6 +33,16 @@ type HttpResp struct {
 	Message string `json:"message"` // 提示信息
 }
 
+// HttpCallback 回调请求内容
+type HttpCallback struct {
+	TaskID string `json:"task_id"`
+	AppID  string `json:"app_id"`
+	Status string `json:"status"` // succeeded|failed
+	Result string `json:"result"` // 最后一次执行结果
+	Error  string `json:"error"`  // 失败原因
+	Times  int64  `json:"times"`  // 执行次数
+}
+
 // Http任务
 type HttpTask struct {
 	SID          string        `json:"sid"`         // Server ID
@@ -45,11 +56,29 @@ type HttpTask struct {
 	lastExecTime time.Duration // 最后一次执行花费时间
 
 	ExpectTime  int64  `json:"expect_time"`  // 等于0:立即执行; 小于一年:延时执行; 其他值:定时执行
+	Priority    int    `json:"priority"`     // 优先级 0-9, 越大越优先
 	AppID       string `json:"app_id"`       // 业务ID
 	URL         string `json:"url"`          // 请求地址
-	Method      string `json:"method"`       // GET|POST
-	ContentType string `json:"content_type"` // 默认为JSON
-	Body        string `json:"body"`         // 请求原数据
+	Method      string `json:"method"`       // GET|POST|PUT|PATCH|DELETE, 默认为GET
+	ContentType string `json:"content_type"` // json|form|text|xml|binary, 默认为json
+	Body        string `json:"body"`         // 请求原数据, form为JSON对象, binary为base64编码
+
+	Headers map[string]string `json:"headers"` // 请求头
+	Query   map[string]string `json:"query"`   // 查询参数, 追加到请求地址
+
+	IdempotencyKey string `json:"idempotency_key"` // 幂等键, 同一业务在去重窗口内重复推送返回原任务ID
+	UniqueKey      string `json:"unique_key"`      // 唯一键, 同一业务同一时间只有一个待执行任务
+	UniquePolicy   string `json:"unique_policy"`   // 已有同键待执行任务时: drop(默认)|replace|extend
+	WorkflowID     string `json:"workflow_id"`     // 所属工作流ID, 由工作流推送节点任务时设置
+
+	OnSuccessURL string `json:"on_success_url"` // 执行成功后回调地址
+	OnFailureURL string `json:"on_failure_url"` // 重试耗尽成为死信后回调地址
+
+	Retry *retry.Policy `json:"retry"` // 重试策略, 为空时使用业务或全局的重试策略
+
+	ExecTimeout int64 `json:"timeout"` // 执行超时时间(秒), 0为DefaultTimeout; 超时后取消请求并按失败重试
+
+	Success *success.Rule `json:"success"` // 成功判断规则, 为空时使用业务或全局的规则
 }
 
 func (t *HttpTask) Init(sid string) {
@@ -67,6 +96,84 @@ func (t *HttpTask) Validate() error {
 	if t.URL == "" {
 		return fmt.Errorf("incorrect parameter: %s", "url")
 	}
+	if t.Priority < PriorityNormal || t.Priority > PriorityMax {
+		return fmt.Errorf("incorrect parameter: %s", "priority")
+	}
+	if err := t.validateRequest(); err != nil {
+		return err
+	}
+	switch t.UniquePolicy {
+	case "", UniqueDrop, UniqueReplace, UniqueExtend:
+	default:
+		return fmt.Errorf("incorrect parameter: %s", "unique_policy")
+	}
+	if t.OnSuccessURL != "" && !isHttpURL(t.OnSuccessURL) {
+		return fmt.Errorf("incorrect parameter: %s", "on_success_url")
+	}
+	if t.OnFailureURL != "" && !isHttpURL(t.OnFailureURL) {
+		return fmt.Errorf("incorrect parameter: %s", "on_failure_url")
+	}
+	if t.ExecTimeout < 0 {
+		return fmt.Errorf("incorrect parameter: %s", "timeout")
+	}
+	if t.Retry != nil {
+		if err := t.Retry.Validate(); err != nil {
+			return err
+		}
+	}
+	if t.Success != nil {
+		if err := t.Success.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *HttpTask) Patch(p Patch) error {
+	patched := *t
+	if p.Task != nil {
+		return t.replace(p.Task)
+	}
+	if p.ExpectTime != nil {
+		patched.ExpectTime = *p.ExpectTime
+	}
+	if p.URL != nil {
+		patched.URL = *p.URL
+	}
+	if p.Body != nil {
+		patched.Body = *p.Body
+	}
+	if err := patched.Validate(); err != nil {
+		return err
+	}
+	*t = patched
+	return nil
+}
+
+// replace 用other替换任务内容, 保留任务ID、来源、执行记录、幂等键和所属工作流
+// 优先级决定任务所在的队列, 不能替换
+func (t *HttpTask) replace(other Tasker) error {
+	o, ok := other.(*HttpTask)
+	if !ok {
+		return fmt.Errorf("incorrect task type: %s", other.GetType())
+	}
+	if o.AppID != t.AppID {
+		return fmt.Errorf("incorrect parameter: %s", "app_id")
+	}
+	if o.Priority != t.Priority {
+		return fmt.Errorf("incorrect parameter: %s", "priority")
+	}
+	replaced := *o
+	//期望执行时间按新任务的创建时间换算为时间戳
+	replaced.ExpectTime = o.GetExpectTime()
+	replaced.SID, replaced.ID, replaced.CreateTime = t.SID, t.ID, t.CreateTime
+	replaced.NextTime, replaced.Times, replaced.Processing = t.NextTime, t.Times, t.Processing
+	replaced.lastResult, replaced.lastError, replaced.lastExecTime = t.lastResult, t.lastError, t.lastExecTime
+	replaced.IdempotencyKey, replaced.WorkflowID = t.IdempotencyKey, t.WorkflowID
+	if err := replaced.Validate(); err != nil {
+		return err
+	}
+	*t = replaced
 	return nil
 }
 
@@ -78,6 +185,10 @@ func (t *HttpTask) SetProcessing() {
 	t.Processing = 1
 }
 
+func (t *HttpTask) UnsetProcessing() {
+	t.Processing = 0
+}
+
 func (t HttpTask) IsProcessing() bool {
 	return t.Processing == 1
 }
@@ -93,6 +204,65 @@ func (t HttpTask) GetExpectTime() int64 {
 	return t.ExpectTime
 }
 
+func (t HttpTask) GetPriority() int {
+	return t.Priority
+}
+
+func (t HttpTask) GetIdempotencyKey() string {
+	return t.IdempotencyKey
+}
+
+func (t HttpTask) GetUniqueKey() string {
+	return t.UniqueKey
+}
+
+func (t HttpTask) GetUniquePolicy() string {
+	if t.UniquePolicy == "" {
+		return UniqueDrop
+	}
+	return t.UniquePolicy
+}
+
+// Callback 返回POST执行结果到回调地址的Http任务, 回调任务失败时同样重试
+func (t HttpTask) Callback(err error, times int64) Tasker {
+	url, data := t.OnSuccessURL, HttpCallback{
+		TaskID: t.ID,
+		AppID:  t.AppID,
+		Status: "succeeded",
+		Result: t.lastResult,
+		Times:  times,
+	}
+	if err != nil {
+		url = t.OnFailureURL
+		data.Status = "failed"
+		data.Error = err.Error()
+	}
+	if url == "" {
+		return nil
+	}
+	b, marshalErr := json.Marshal(data)
+	if marshalErr != nil {
+		log.Error("task callback marshal err, task: ", t.ID, " err: ", marshalErr)
+		return nil
+	}
+	return &HttpTask{
+		Priority:    t.Priority,
+		AppID:       t.AppID,
+		URL:         url,
+		Method:      http.MethodPost,
+		ContentType: ContentJSON,
+		Body:        string(b),
+	}
+}
+
+func (t HttpTask) GetWorkflowID() string {
+	return t.WorkflowID
+}
+
+func (t *HttpTask) SetWorkflowID(id string) {
+	t.WorkflowID = id
+}
+
 func (t HttpTask) GetAppID() string {
 	return t.AppID
 }
@@ -107,39 +277,53 @@ func (t HttpTask) GetSID() string {
 
 func (t *HttpTask) Run(ctx context.Context, token string) (result interface{}, err error) {
 	log.Info("Run Task: ", t.ID, "SID: ", t.SID, "Data: ", *t)
-	// 处理http请求
-	client := httpclient.New()
-	client.SetHeader(headerUTaskId, t.ID)
-	client.SetHeader(headerUTaskToken, token)
-	startTime := time.Now()
-	var resp *httpclient.Response
-	switch strings.ToUpper(t.Method) {
-	case http.MethodPost:
-		resp, err = client.PostJson(t.URL, t.Body)
-	default:
-		resp, err = client.Get(t.URL, nil)
+	// 处理http请求, ctx超时时取消请求
+	req, err := t.request(ctx, token)
+	if err != nil {
+		t.lastError = err
+		return nil, t.lastError
 	}
+	startTime := time.Now()
+	status, data, err := t.do(req)
 	t.lastExecTime = time.Now().Sub(startTime)
 	if err != nil {
 		t.lastError = err
 		return nil, t.lastError
 	}
 
-	// 检测接口约定返回值
-	t.lastResult = resp.String()
-	res := &HttpResp{}
-	if err := resp.Decode(res); err != nil {
+	// 按成功规则检测返回值, 永久失败的任务不再重试
+	t.lastResult = string(data)
+	rule := t.successRule()
+	if err := rule.Check(status, data); err != nil {
 		t.lastError = err
+		if rule.IsPermanent(status) {
+			t.lastError = Permanent(err)
+		}
 		return nil, t.lastError
 	}
+	return t.lastResult, nil
+}
 
-	// 错误码不等于0时表示失败
-	if res.Code != 0 {
-		err := fmt.Errorf("code=%d error=%s", res.Code, res.Message)
-		t.lastError = err
-		return nil, t.lastError
+// do 发送请求并读取状态码和响应内容
+func (t HttpTask) do(req *http.Request) (int, []byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// successRule 依次使用任务、业务、全局的成功判断规则
+func (t HttpTask) successRule() success.Rule {
+	if t.Success != nil {
+		return *t.Success
+	}
+	if v, ok := app.Config.Success.Apps[t.AppID]; ok {
+		return v
 	}
-	return res, nil
+	return app.Config.Success.Default
 }
 
 func (t HttpTask) GetTimes() int64 {
@@ -148,19 +332,38 @@ func (t HttpTask) GetTimes() int64 {
 
 func (t *HttpTask) IncreaseTimes() {
 	t.Times += 1
-	t.NextTime = time.Now().Unix() + t.Times*t.Times*1
+}
+
+func (t *HttpTask) ResetTimes() {
+	t.Times = 0
+	t.NextTime = 0
 }
 
 func (t HttpTask) GetNextTime() int64 {
 	return t.NextTime
 }
 
+func (t HttpTask) GetRetryPolicy() *retry.Policy {
+	return t.Retry
+}
+
+func (t *HttpTask) SetNextTime(at int64) {
+	t.NextTime = at
+}
+
+// MaxRetryTimes 返回任务重试策略的最大执行次数, 0为使用业务或全局配置
 func (t HttpTask) MaxRetryTimes() int {
-	return 6
+	if t.Retry == nil {
+		return 0
+	}
+	return t.Retry.MaxTimes
 }
 
 func (t HttpTask) Timeout() int64 {
-	return 300
+	if t.ExecTimeout > 0 {
+		return t.ExecTimeout
+	}
+	return DefaultTimeout
 }
 
 func (t HttpTask) GetContent() string {
@@ -169,7 +372,10 @@ func (t HttpTask) GetContent() string {
 		"method":       t.Method,
 		"body":         t.Body,
 		"content_type": t.ContentType,
+		"headers":      t.Headers,
+		"query":        t.Query,
 		"expect_time":  t.ExpectTime,
+		"priority":     t.Priority,
 	}
 	b, _ := json.Marshal(content)
 	return string(b)
@@ -0,0 +1,62 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCallback(t *testing.T) {
+	item := HttpTask{ID: "t1", AppID: "100", Times: 2, OnSuccessURL: "http://example.com/ok", OnFailureURL: "http://example.com/fail"}
+	cases := []struct {
+		name   string
+		err    error
+		times  int64
+		url    string
+		status string
+	}{
+		{"succeeded", nil, 3, "http://example.com/ok", "succeeded"},
+		{"failed", errors.New("exceeded max retry times"), 2, "http://example.com/fail", "failed"},
+	}
+	for _, c := range cases {
+		cb, ok := item.Callback(c.err, c.times).(*HttpTask)
+		if !ok {
+			t.Fatalf("%s: Callback() = nil", c.name)
+		}
+		data := HttpCallback{}
+		if err := json.Unmarshal([]byte(cb.Body), &data); err != nil {
+			t.Fatal(err)
+		}
+		if cb.URL != c.url || data.Status != c.status || data.Times != c.times || data.TaskID != "t1" {
+			t.Errorf("%s: Callback() = %s %+v", c.name, cb.URL, data)
+		}
+	}
+	if cb := (HttpTask{ID: "t2"}).Callback(nil, 1); cb != nil {
+		t.Errorf("Callback() without url = %v, want nil", cb)
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	cases := []struct {
+		success string
+		failure string
+		want    string
+	}{
+		{"", "", ""},
+		{"https://example.com/ok", "http://example.com:8080/fail", ""},
+		{"example.com/ok", "", "incorrect parameter: on_success_url"},
+		{"ftp://example.com/ok", "", "incorrect parameter: on_success_url"},
+		{"", "http:///fail", "incorrect parameter: on_failure_url"},
+		{"", "://bad", "incorrect parameter: on_failure_url"},
+	}
+	for _, c := range cases {
+		item := HttpTask{AppID: "100", URL: "http://example.com", OnSuccessURL: c.success, OnFailureURL: c.failure}
+		got := ""
+		if err := item.Validate(); err != nil {
+			got = err.Error()
+		}
+		if got != c.want {
+			t.Errorf("Validate(%q, %q) = %q, want %q", c.success, c.failure, got, c.want)
+		}
+	}
+}
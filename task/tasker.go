@@ -1,6 +1,21 @@
 package task
 
-import "context"
+import (
+	"context"
+	"errors"
+
+	"github.com/meixiu/utask/pkg/retry"
+)
+
+const (
+	// PriorityNormal 默认优先级
+	PriorityNormal = 0
+	// PriorityMax 最高优先级, 数值越大越优先
+	PriorityMax = 9
+)
+
+// DefaultTimeout 任务未设置超时时间时的执行超时时间(秒)
+var DefaultTimeout = int64(300)
 
 // Tasker 是任务接口，规范任务行为
 type Tasker interface {
@@ -24,7 +39,7 @@ type Tasker interface {
 	SetProcessing()
 	//IsProcessing 获取任务是否在待处理队列中
 	IsProcessing() bool
-	//IncreaseTimes 增加出错次数
+	//IncreaseTimes 增加出错次数, 下次执行时间由重试策略设置
 	IncreaseTimes()
 	//GetTimes 获取执行次数
 	GetTimes() int64
@@ -44,6 +59,114 @@ type Tasker interface {
 	GetLastExecTime() int64
 }
 
+// Patch 未执行任务的修改内容, 为nil的字段不修改
+type Patch struct {
+	ExpectTime *int64  `json:"expect_time"` // 与创建任务时含义相同
+	URL        *string `json:"url"`
+	Body       *string `json:"body"`
+
+	Task Tasker `json:"-"` // 不为nil时用该任务替换除任务ID、来源和执行记录外的全部内容, 其他字段不生效
+}
+
+// Patcher 能修改未执行任务的任务类型
+type Patcher interface {
+	//Patch 修改任务, 修改后校验失败时任务保持不变
+	Patch(p Patch) error
+}
+
+// Prioritizer 能设置优先级的任务类型
+type Prioritizer interface {
+	//GetPriority 获取任务优先级, 取值PriorityNormal-PriorityMax
+	GetPriority() int
+}
+
+// Resetter 能重新执行死信的任务类型
+type Resetter interface {
+	//ResetTimes 重置执行次数和下次执行时间
+	ResetTimes()
+}
+
+// Processor 能清除待处理队列标记的任务类型
+type Processor interface {
+	//UnsetProcessing 设置任务离开待处理队列
+	UnsetProcessing()
+}
+
+// Normalizer 能在执行前兼容旧版本任务数据的任务类型
+type Normalizer interface {
+	//Normalize 将推送时未校验、当前版本不支持的参数改为旧版本的执行方式, 有修改时返回true
+	Normalize() bool
+}
+
+// Idempotent 能携带幂等键的任务类型
+type Idempotent interface {
+	//GetIdempotencyKey 获取推送时的幂等键, 为空时不去重
+	GetIdempotencyKey() string
+}
+
+const (
+	UniqueDrop    = "drop"    // 已有同键待执行任务时丢弃新任务
+	UniqueReplace = "replace" // 用新任务的执行时间和内容替换待执行任务
+	UniqueExtend  = "extend"  // 将待执行任务延后到新任务的执行时间
+)
+
+// Unique 能按唯一键限制同一时间只有一个待执行任务的任务类型
+type Unique interface {
+	//GetUniqueKey 获取业务唯一键, 为空时不限制
+	GetUniqueKey() string
+	//GetUniquePolicy 获取已有同键待执行任务时的处理策略, 默认为UniqueDrop
+	GetUniquePolicy() string
+}
+
+// Retrier 能按重试策略设置下次执行时间的任务类型
+type Retrier interface {
+	//GetRetryPolicy 获取任务的重试策略, 为nil时使用业务或全局的重试策略
+	GetRetryPolicy() *retry.Policy
+	//SetNextTime 设置下次执行时间
+	SetNextTime(at int64)
+}
+
+// Callbacker 能在执行成功或最终失败后回调推送方的任务类型
+type Callbacker interface {
+	//Callback 返回通知推送方执行结果的回调任务, err为nil表示执行成功, times为已执行次数, 没有回调地址或无法生成回调内容时返回nil
+	Callback(err error, times int64) Tasker
+}
+
+// Workflower 能作为工作流节点执行的任务类型
+type Workflower interface {
+	//GetWorkflowID 获取所属工作流ID, 为空时不属于工作流
+	GetWorkflowID() string
+	//SetWorkflowID 设置所属工作流ID
+	SetWorkflowID(id string)
+}
+
+// PermanentError 永久失败的错误, 任务不再重试, 直接移入死信
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent 将err标记为永久失败
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent 判断err是否为永久失败
+func IsPermanent(err error) bool {
+	var p *PermanentError
+	return errors.As(err, &p)
+}
+
 // Register 注册任务表类型
 type Register map[string]func() Tasker
 
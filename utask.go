@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
@@ -11,16 +12,35 @@ import (
 
 	"github.com/meixiu/utask/app"
 	"github.com/meixiu/utask/client"
+	"github.com/meixiu/utask/schedule"
 	"github.com/meixiu/utask/server"
+	"github.com/meixiu/utask/store"
 )
 
 func main() {
+	file := flag.String("c", "config/dev.yaml", "config file path")
+	flag.Parse()
+	if err := app.Load(*file); err != nil {
+		log.Fatal(err)
+	}
+	if err := store.Init(); err != nil {
+		log.Fatal(err)
+	}
+
+	//子命令: migrate-coder 将已存储的任务数据改写为当前配置的编码格式
+	if flag.Arg(0) == "migrate-coder" {
+		migrateCoder()
+		return
+	}
+
 	srvOpts := server.NewOptions()
 	s := server.NewHttpServer(app.ServerId(), srvOpts)
 
 	cliOpts := client.NewOptions()
 	c := client.NewChanClient(app.ClientId(), cliOpts)
 
+	sch := schedule.NewScheduler(app.ClientId(), schedule.NewOptions())
+
 	go func() {
 		_ = s.ListenAndServe()
 	}()
@@ -28,6 +48,10 @@ func main() {
 	go func() {
 		_ = c.Start()
 	}()
+
+	go func() {
+		_ = sch.Start()
+	}()
 	log.Println("Start @", app.Config.Version)
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 5 seconds.
@@ -53,6 +77,36 @@ func main() {
 			log.Println("Queue Shutdown:", err)
 		}
 	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := sch.Stop(ctx); err != nil {
+			log.Println("Scheduler Shutdown:", err)
+		}
+	}()
 	wg.Wait()
 	log.Println("Exiting")
 }
+
+// migrateCoder 依次改写任务数据源和任务处理区中已存储的任务数据
+func migrateCoder() {
+	stores := []struct {
+		name  string
+		store interface{}
+	}{
+		{"redis", store.DefaultRedisStore},
+		{"db", store.DefaultDbStore},
+	}
+	log.Println("Migrate coder to", app.Config.Coder)
+	for _, v := range stores {
+		s, ok := v.store.(store.MigrateStorer)
+		if !ok {
+			continue
+		}
+		count, err := s.Migrate()
+		if err != nil {
+			log.Fatalln("Migrate", v.name, "err:", err)
+		}
+		log.Println("Migrate", v.name, "rewrote:", count)
+	}
+}
@@ -0,0 +1,43 @@
+package workflow
+
+import (
+	"github.com/meixiu/utask/store"
+)
+
+// Options option info
+type Options struct {
+	TaskStore     store.TaskStorer
+	WorkflowStore store.WorkflowStorer
+}
+
+// Option Option
+type Option func(*Options)
+
+// NewOptions construct
+func NewOptions(opts ...Option) Options {
+	opt := Options{
+		TaskStore: store.DefaultRedisStore,
+	}
+	//工作流区使用任务处理区的数据库
+	if s, ok := store.DefaultDbStore.(store.WorkflowStorer); ok {
+		opt.WorkflowStore = s
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	return opt
+}
+
+// TaskStore task store
+func TaskStore(t store.TaskStorer) Option {
+	return func(o *Options) {
+		o.TaskStore = t
+	}
+}
+
+// WorkflowStore workflow store
+func WorkflowStore(w store.WorkflowStorer) Option {
+	return func(o *Options) {
+		o.WorkflowStore = w
+	}
+}
@@ -0,0 +1,343 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/meixiu/utask/log"
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/task"
+)
+
+// MaxNodes 单个工作流的最大节点数
+var MaxNodes = 100
+
+// StallTime 工作流创建后超过该时间仍没有已推送的节点时重新推送就绪节点
+var StallTime = 10 * time.Second
+
+var (
+	// ErrNotSupport 未配置工作流区
+	ErrNotSupport = errors.New("workflow store not configured")
+	// ErrCycle 节点依赖存在环
+	ErrCycle = errors.New("incorrect parameter: nodes, dependency cycle")
+)
+
+// Node 工作流节点定义, 依赖的节点全部执行成功后推送Task
+type Node struct {
+	Name    string
+	Depends []string
+	Task    task.Tasker
+}
+
+// Runner 工作流执行器
+// 服务端创建工作流并推送根节点, 消费端在节点任务成功或失败后推进工作流
+type Runner struct {
+	sid string // 推送节点任务的来源ID
+
+	taskStore     store.TaskStorer     // 任务数据源
+	workflowStore store.WorkflowStorer // 工作流区
+}
+
+// NewRunner 返回一个工作流执行器
+func NewRunner(sid string, opts Options) *Runner {
+	return &Runner{
+		sid:           sid,
+		taskStore:     opts.TaskStore,
+		workflowStore: opts.WorkflowStore,
+	}
+}
+
+// Enabled 是否已配置工作流区
+func (r *Runner) Enabled() bool {
+	return r.workflowStore != nil
+}
+
+// Validate 校验节点定义: 名称唯一, 依赖的节点存在且没有环, 任务属于同一业务
+func Validate(appId string, nodes []Node) error {
+	if len(nodes) == 0 || len(nodes) > MaxNodes {
+		return fmt.Errorf("incorrect parameter: nodes, size must be 1-%d", MaxNodes)
+	}
+	indegree := make(map[string]int, len(nodes))
+	for _, n := range nodes {
+		if n.Name == "" || strings.Contains(n.Name, ",") {
+			return fmt.Errorf("incorrect parameter: node name %q", n.Name)
+		}
+		if _, ok := indegree[n.Name]; ok {
+			return fmt.Errorf("incorrect parameter: duplicated node %q", n.Name)
+		}
+		indegree[n.Name] = len(n.Depends)
+	}
+	children := make(map[string][]string, len(nodes))
+	for _, n := range nodes {
+		seen := make(map[string]bool, len(n.Depends))
+		for _, d := range n.Depends {
+			if _, ok := indegree[d]; !ok || d == n.Name || seen[d] {
+				return fmt.Errorf("incorrect parameter: node %q depends %q", n.Name, d)
+			}
+			seen[d] = true
+			children[d] = append(children[d], n.Name)
+		}
+		if n.Task == nil {
+			return fmt.Errorf("incorrect parameter: node %q task", n.Name)
+		}
+		if _, ok := n.Task.(task.Workflower); !ok {
+			return fmt.Errorf("incorrect parameter: node %q task type %s", n.Name, n.Task.GetType())
+		}
+		if err := n.Task.Validate(); err != nil {
+			return fmt.Errorf("node %q: %w", n.Name, err)
+		}
+		if n.Task.GetAppID() != appId {
+			return fmt.Errorf("incorrect parameter: node %q app_id", n.Name)
+		}
+	}
+	//拓扑排序能访问全部节点时没有环
+	queue := make([]string, 0, len(nodes))
+	for name, d := range indegree {
+		if d == 0 {
+			queue = append(queue, name)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, c := range children[name] {
+			indegree[c]--
+			if indegree[c] == 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	if visited != len(nodes) {
+		return ErrCycle
+	}
+	return nil
+}
+
+// Create 保存工作流并推送没有依赖的节点
+func (r *Runner) Create(appId, name string, nodes []Node) (*store.TaskWorkflow, error) {
+	if r.workflowStore == nil {
+		return nil, ErrNotSupport
+	}
+	if err := Validate(appId, nodes); err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	wf := &store.TaskWorkflow{
+		WorkflowID: uuid.New().String(),
+		AppID:      appId,
+		Name:       name,
+		Status:     store.WorkflowRunning,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	items := make([]store.TaskWorkflowNode, 0, len(nodes))
+	for _, n := range nodes {
+		b, err := store.Encode(n.Task)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, store.TaskWorkflowNode{
+			WorkflowID: wf.WorkflowID,
+			Name:       n.Name,
+			Depends:    strings.Join(n.Depends, ","),
+			Task:       b,
+			Content:    store.Readable(n.Task.GetContent()),
+			Status:     store.NodeWaiting,
+			CreateTime: now,
+			UpdateTime: now,
+		})
+	}
+	if err := r.workflowStore.AddWorkflow(wf, items); err != nil {
+		return nil, err
+	}
+	if err := r.next(wf.WorkflowID); err != nil {
+		//根节点推送失败时工作流直接失败, 避免一直处于运行中
+		r.finish(wf.WorkflowID, store.WorkflowFailed, err.Error())
+		return nil, err
+	}
+	return wf, nil
+}
+
+// Advance 节点任务执行成功, 推送依赖已全部成功的节点
+func (r *Runner) Advance(item task.Tasker) error {
+	node, err := r.node(item)
+	if err != nil || node == nil {
+		return err
+	}
+	ok, err := r.workflowStore.SetNode(node.ID, store.NodePushed, store.NodeSucceeded, "")
+	if err != nil || !ok {
+		//重复执行成功的任务只推进一次
+		return err
+	}
+	log.Info("workflow node succeeded: ", node.WorkflowID, " node: ", node.Name, " task: ", node.TID)
+	return r.next(node.WorkflowID)
+}
+
+// Fail 节点任务成为死信或被取消, 工作流失败且未推送的节点不再执行
+func (r *Runner) Fail(item task.Tasker, reason string) error {
+	node, err := r.node(item)
+	if err != nil || node == nil {
+		return err
+	}
+	return r.fail(node, reason)
+}
+
+// Cancel 节点任务在推送后被取消, 任务不会再进入执行流程, 直接使工作流失败
+func (r *Runner) Cancel(tid string) error {
+	if r.workflowStore == nil {
+		return nil
+	}
+	node, err := r.workflowStore.NodeOf(tid)
+	if err != nil || node == nil {
+		return err
+	}
+	return r.fail(node, "cancelled")
+}
+
+// Sweep 重新推送停滞工作流的就绪节点, 返回处理的工作流数
+// 节点推送失败且没有其他运行中的节点时, 不会再有完成的节点推进工作流
+func (r *Runner) Sweep(size int) (int, error) {
+	if r.workflowStore == nil {
+		return 0, nil
+	}
+	ids, err := r.workflowStore.StalledWorkflows(time.Now().Add(-StallTime).Unix(), size)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := r.next(id); err != nil {
+			log.Error("workflow sweep err, workflow: ", id, " err: ", err)
+		}
+	}
+	return len(ids), nil
+}
+
+// fail 已推送的节点失败, 工作流失败且跳过等待中的节点
+func (r *Runner) fail(node *store.TaskWorkflowNode, reason string) error {
+	ok, err := r.workflowStore.SetNode(node.ID, store.NodePushed, store.NodeFailed, "")
+	if err != nil || !ok {
+		return err
+	}
+	log.Info("workflow node failed: ", node.WorkflowID, " node: ", node.Name, " task: ", node.TID, " reason: ", reason)
+	r.finish(node.WorkflowID, store.WorkflowFailed, fmt.Sprintf("node %s: %s", node.Name, reason))
+	_, nodes, err := r.workflowStore.GetWorkflow(node.WorkflowID)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if n.Status != store.NodeWaiting {
+			continue
+		}
+		if _, err := r.workflowStore.SetNode(n.ID, store.NodeWaiting, store.NodeSkipped, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// node 查询任务所属的工作流节点, 不属于工作流的任务返回nil
+func (r *Runner) node(item task.Tasker) (*store.TaskWorkflowNode, error) {
+	if r.workflowStore == nil {
+		return nil, nil
+	}
+	w, ok := item.(task.Workflower)
+	if !ok || w.GetWorkflowID() == "" {
+		return nil, nil
+	}
+	node, err := r.workflowStore.NodeOf(item.GetID())
+	if err != nil || node == nil || node.WorkflowID != w.GetWorkflowID() {
+		return nil, err
+	}
+	return node, nil
+}
+
+// next 推送依赖已全部成功的等待节点, 全部节点成功时工作流成功
+func (r *Runner) next(id string) error {
+	wf, nodes, err := r.workflowStore.GetWorkflow(id)
+	if err != nil || wf == nil {
+		return err
+	}
+	if wf.Status != store.WorkflowRunning {
+		return nil
+	}
+	status := make(map[string]int, len(nodes))
+	for _, n := range nodes {
+		status[n.Name] = n.Status
+	}
+	succeeded := 0
+	for i := range nodes {
+		n := &nodes[i]
+		if n.Status == store.NodeSucceeded {
+			succeeded++
+			continue
+		}
+		if n.Status != store.NodeWaiting || !ready(n, status) {
+			continue
+		}
+		if err := r.push(n); err != nil {
+			return err
+		}
+	}
+	if succeeded == len(nodes) {
+		r.finish(id, store.WorkflowSucceeded, "")
+	}
+	return nil
+}
+
+// push 按节点的任务模板生成任务并推送, 节点已被其他执行者推送时跳过
+func (r *Runner) push(n *store.TaskWorkflowNode) error {
+	item, err := store.Decode(n.Task)
+	if err != nil {
+		return err
+	}
+	item.Init(r.sid)
+	item.(task.Workflower).SetWorkflowID(n.WorkflowID)
+	//先记录节点的任务ID, 推送后节点任务完成时才能找到节点
+	ok, err := r.workflowStore.SetNode(n.ID, store.NodeWaiting, store.NodePushed, item.GetID())
+	if err != nil || !ok {
+		return err
+	}
+	ok, err = r.taskStore.RPush(item)
+	if err == nil && !ok {
+		err = errors.New("add queue error")
+	}
+	if err != nil {
+		//推送失败时恢复等待, 由下一个完成的节点或Sweep重试推送
+		if _, resetErr := r.workflowStore.SetNode(n.ID, store.NodePushed, store.NodeWaiting, ""); resetErr != nil {
+			log.Error("workflow node reset err, node: ", n.Name, " err: ", resetErr)
+		}
+		return err
+	}
+	log.Info("workflow push: ", n.WorkflowID, " node: ", n.Name, " task: ", item.GetID())
+	return nil
+}
+
+// finish 结束运行中的工作流
+func (r *Runner) finish(id string, status int, reason string) {
+	ok, err := r.workflowStore.FinishWorkflow(id, status, reason)
+	if err != nil {
+		log.Error("workflow finish err, workflow: ", id, " err: ", err)
+		return
+	}
+	if ok {
+		log.Info("workflow finished: ", id, " status: ", status)
+	}
+}
+
+// ready 节点依赖的节点是否全部执行成功
+func ready(n *store.TaskWorkflowNode, status map[string]int) bool {
+	if n.Depends == "" {
+		return true
+	}
+	for _, d := range strings.Split(n.Depends, ",") {
+		if status[d] != store.NodeSucceeded {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package workflow
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/meixiu/utask/store"
+	"github.com/meixiu/utask/store/memory"
+	"github.com/meixiu/utask/task"
+)
+
+func TestValidate(t *testing.T) {
+	node := func(name string, depends ...string) Node {
+		return Node{Name: name, Depends: depends, Task: &task.HttpTask{AppID: "100", URL: "http://example.com"}}
+	}
+	many := make([]Node, MaxNodes+1)
+	for i := range many {
+		many[i] = node(strconv.Itoa(i))
+	}
+	other := node("b")
+	other.Task = &task.HttpTask{AppID: "200", URL: "http://example.com"}
+	invalid := node("b")
+	invalid.Task = &task.HttpTask{AppID: "100", URL: "example"}
+	untyped := node("b")
+	untyped.Task = nil
+
+	cases := []struct {
+		name  string
+		nodes []Node
+		ok    bool
+		err   error
+	}{
+		{"single", []Node{node("a")}, true, nil},
+		{"chain", []Node{node("a"), node("b", "a"), node("c", "b")}, true, nil},
+		{"diamond", []Node{node("a"), node("b", "a"), node("c", "a"), node("d", "b", "c")}, true, nil},
+		{"empty", nil, false, nil},
+		{"too many", many, false, nil},
+		{"empty name", []Node{node("")}, false, nil},
+		{"comma in name", []Node{node("a,b")}, false, nil},
+		{"duplicated", []Node{node("a"), node("a")}, false, nil},
+		{"unknown depend", []Node{node("a", "x")}, false, nil},
+		{"self depend", []Node{node("a", "a")}, false, nil},
+		{"duplicated depend", []Node{node("a"), node("b", "a", "a")}, false, nil},
+		{"cycle", []Node{node("a", "c"), node("b", "a"), node("c", "b")}, false, ErrCycle},
+		{"cycle behind root", []Node{node("a"), node("b", "a", "c"), node("c", "b")}, false, ErrCycle},
+		{"nil task", []Node{node("a"), untyped}, false, nil},
+		{"other app", []Node{node("a"), other}, false, nil},
+		{"invalid task", []Node{node("a"), invalid}, false, nil},
+	}
+	for _, c := range cases {
+		err := Validate("100", c.nodes)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: Validate() = %v, want ok %v", c.name, err, c.ok)
+		}
+		if c.err != nil && !errors.Is(err, c.err) {
+			t.Errorf("%s: Validate() = %v, want %v", c.name, err, c.err)
+		}
+	}
+}
+
+// flakyStore 推送可以失败的任务数据源
+type flakyStore struct {
+	*memory.Store
+	fail bool
+}
+
+func (s *flakyStore) RPush(item task.Tasker) (bool, error) {
+	if s.fail {
+		return false, errors.New("push failed")
+	}
+	return s.Store.RPush(item)
+}
+
+func TestSweepAndCancel(t *testing.T) {
+	m := memory.NewStore()
+	ts := &flakyStore{Store: m}
+	r := NewRunner("test", NewOptions(TaskStore(ts), WorkflowStore(m)))
+	node := func(name string, depends ...string) Node {
+		return Node{Name: name, Depends: depends, Task: &task.HttpTask{AppID: "100", URL: "http://example.com"}}
+	}
+	wf, err := r.Create("100", "w", []Node{node("a"), node("b", "a"), node("c", "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := func() map[string]int {
+		_, nodes, _ := m.GetWorkflow(wf.WorkflowID)
+		v := make(map[string]int, len(nodes))
+		for _, n := range nodes {
+			v[n.Name] = n.Status
+		}
+		return v
+	}
+	taskOf := func(name string) task.Tasker {
+		_, nodes, _ := m.GetWorkflow(wf.WorkflowID)
+		for _, n := range nodes {
+			if n.Name == name {
+				return &task.HttpTask{ID: n.TID, WorkflowID: wf.WorkflowID}
+			}
+		}
+		return nil
+	}
+
+	//b推送失败后没有运行中的节点, 由Sweep重新推送
+	ts.fail = true
+	if err := r.Advance(taskOf("a")); err == nil {
+		t.Fatal("Advance() with failed push err = nil")
+	}
+	if st := status(); st["b"] != store.NodeWaiting {
+		t.Fatalf("node b status = %d, want waiting", st["b"])
+	}
+	ts.fail = false
+	defer func(v time.Duration) { StallTime = v }(StallTime)
+	StallTime = -time.Minute
+	if n, err := r.Sweep(10); err != nil || n != 1 {
+		t.Fatalf("Sweep() = %d, %v, want 1", n, err)
+	}
+	if st := status(); st["b"] != store.NodePushed {
+		t.Fatalf("node b status = %d, want pushed", st["b"])
+	}
+	if n, _ := r.Sweep(10); n != 0 {
+		t.Errorf("Sweep() with pushed node = %d, want 0", n)
+	}
+
+	//取消已推送的节点任务, 工作流失败且跳过后续节点
+	if err := r.Cancel(taskOf("b").GetID()); err != nil {
+		t.Fatal(err)
+	}
+	got, _, _ := m.GetWorkflow(wf.WorkflowID)
+	if st := status(); got.Status != store.WorkflowFailed || st["b"] != store.NodeFailed || st["c"] != store.NodeSkipped {
+		t.Errorf("after cancel workflow = %d, nodes = %v", got.Status, st)
+	}
+}